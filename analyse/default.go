@@ -0,0 +1,55 @@
+package analyse
+
+import (
+	"bytes"
+	_ "embed" // for the bundled IDF and stop words
+	"sync"
+
+	"github.com/kricen/jiebago"
+)
+
+var (
+	//go:embed idf.txt
+	defaultIdf []byte
+	//go:embed stop_words.txt
+	defaultStopWords []byte
+)
+
+// NewTagExtracterDefault creates a TagExtracter with the bundled dictionary,
+// IDF and stop words loaded. Use LoadDictionary, LoadIdf and LoadStopWords to
+// replace any of them.
+func NewTagExtracterDefault() (*TagExtracter, error) {
+	seg, err := jiebago.NewWithDefault()
+	if err != nil {
+		return nil, err
+	}
+	t := &TagExtracter{seg: seg, idf: NewIdf(), stopWord: NewStopWord()}
+	if err := t.idf.loadDictionaryReader(bytes.NewReader(defaultIdf)); err != nil {
+		return nil, err
+	}
+	if err := t.stopWord.loadDictionaryReader(bytes.NewReader(defaultStopWords)); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+var (
+	highlighterOnce sync.Once
+	highlighter     *TagExtracter
+)
+
+// Highlight cuts text into words with the bundled dictionary and surrounds
+// every word found in tags with left and right, for example "<b>" and
+// "</b>", see TagExtracter.Highlight. Words are only matched as a whole, so
+// matches never overlap, and all the other text is kept verbatim. Use
+// TagExtracter.Highlight to cut text with another dictionary.
+func Highlight(text string, tags Segments, left, right string) string {
+	highlighterOnce.Do(func() {
+		seg, err := jiebago.NewWithDefault()
+		if err != nil {
+			panic(err)
+		}
+		highlighter = &TagExtracter{seg: seg}
+	})
+	return highlighter.Highlight(text, tags, left, right)
+}
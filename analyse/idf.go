@@ -1,6 +1,8 @@
 package analyse
 
 import (
+	"io"
+	"math"
 	"sort"
 	"sync"
 
@@ -13,6 +15,10 @@ type Idf struct {
 	freqMap map[string]float64
 	median  float64
 	freqs   []float64
+	// docCount and docFreqs are the number of documents added by AddDocument
+	// and the number of those documents containing every word.
+	docCount int
+	docFreqs map[string]int
 	sync.RWMutex
 }
 
@@ -21,9 +27,16 @@ func (i *Idf) AddToken(token dictionary.Token) {
 	i.Lock()
 	i.freqMap[token.Text()] = token.Frequency()
 	i.freqs = append(i.freqs, token.Frequency())
+	i.updateMedian()
+	i.Unlock()
+}
+
+func (i *Idf) updateMedian() {
+	if len(i.freqs) == 0 {
+		return
+	}
 	sort.Float64s(i.freqs)
 	i.median = i.freqs[len(i.freqs)/2]
-	i.Unlock()
 }
 
 // Load loads all tokens from channel into it's dictionary.
@@ -33,8 +46,7 @@ func (i *Idf) Load(ch <-chan dictionary.Token) {
 		i.freqMap[token.Text()] = token.Frequency()
 		i.freqs = append(i.freqs, token.Frequency())
 	}
-	sort.Float64s(i.freqs)
-	i.median = i.freqs[len(i.freqs)/2]
+	i.updateMedian()
 	i.Unlock()
 }
 
@@ -42,6 +54,10 @@ func (i *Idf) loadDictionary(fileName string) error {
 	return dictionary.LoadDictionary(i, fileName)
 }
 
+func (i *Idf) loadDictionaryReader(r io.Reader) error {
+	return dictionary.LoadDictionaryReader(i, r)
+}
+
 // Frequency returns the IDF of given word.
 func (i *Idf) Frequency(key string) (float64, bool) {
 	i.RLock()
@@ -50,7 +66,113 @@ func (i *Idf) Frequency(key string) (float64, bool) {
 	return freq, ok
 }
 
+// Len returns the number of words in it's dictionary.
+func (i *Idf) Len() int {
+	i.RLock()
+	n := len(i.freqMap)
+	i.RUnlock()
+	return n
+}
+
+// Range calls f for every word and its IDF in the order of words, it stops
+// once f returns false. f works on a snapshot, so it could call other methods
+// of the Idf.
+func (i *Idf) Range(f func(word string, idf float64) bool) {
+	i.RLock()
+	words := make([]string, 0, len(i.freqMap))
+	for word := range i.freqMap {
+		words = append(words, word)
+	}
+	freqs := make(map[string]float64, len(i.freqMap))
+	for word, freq := range i.freqMap {
+		freqs[word] = freq
+	}
+	i.RUnlock()
+	sort.Strings(words)
+	for _, word := range words {
+		if !f(word, freqs[word]) {
+			return
+		}
+	}
+}
+
+// Median returns the median IDF, which is used for words not found in the
+// dictionary.
+func (i *Idf) Median() float64 {
+	i.RLock()
+	median := i.median
+	i.RUnlock()
+	return median
+}
+
+// SetMedian overrides the median IDF. Note that the median is recomputed
+// whenever new tokens are added or loaded.
+func (i *Idf) SetMedian(v float64) {
+	i.Lock()
+	i.median = v
+	i.Unlock()
+}
+
 // NewIdf creates a new Idf instance.
 func NewIdf() *Idf {
 	return &Idf{freqMap: make(map[string]float64), freqs: make([]float64, 0)}
 }
+
+// NewIdfFromMap creates a new Idf instance with words and their IDFs from
+// given map, the median is computed the same way as loading from file.
+func NewIdfFromMap(freqs map[string]float64) *Idf {
+	i := NewIdf()
+	i.Build(freqs)
+	return i
+}
+
+// Build replaces all the words in it's dictionary with words and their IDFs
+// from given map, and recomputes the median.
+func (i *Idf) Build(freqs map[string]float64) {
+	i.Lock()
+	i.freqMap = make(map[string]float64, len(freqs))
+	i.freqs = make([]float64, 0, len(freqs))
+	for word, freq := range freqs {
+		i.freqMap[word] = freq
+		i.freqs = append(i.freqs, freq)
+	}
+	i.median = 0
+	i.updateMedian()
+	i.Unlock()
+}
+
+// AddDocument counts the distinct words of one document for Recompute, the
+// IDFs are not changed until Recompute is called.
+func (i *Idf) AddDocument(words []string) {
+	i.Lock()
+	if i.docFreqs == nil {
+		i.docFreqs = make(map[string]int)
+	}
+	seen := make(map[string]bool, len(words))
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			i.docFreqs[word]++
+		}
+	}
+	i.docCount++
+	i.Unlock()
+}
+
+// Recompute updates the IDF of every word counted by AddDocument as
+// log(N/df), where N is the number of documents added and df is the number of
+// those documents containing the word, and recomputes the median. The IDFs of
+// other words, e.g. loaded from file, are kept.
+func (i *Idf) Recompute() {
+	i.Lock()
+	n := float64(i.docCount)
+	for word, df := range i.docFreqs {
+		i.freqMap[word] = math.Log(n / float64(df))
+	}
+	i.freqs = i.freqs[:0]
+	for _, freq := range i.freqMap {
+		i.freqs = append(i.freqs, freq)
+	}
+	i.updateMedian()
+	i.Unlock()
+}
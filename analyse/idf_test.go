@@ -0,0 +1,122 @@
+package analyse
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestIdfMedian(t *testing.T) {
+	te := newTestTagExtracter("收入 100 n\n增长 100 v\n", "收入 1\n增长 3\n其他 5\n")
+	if median := te.GetIdf().Median(); median != 3 {
+		t.Fatalf("got median %f, expected 3", median)
+	}
+	te.MinWordLen = 1
+	sentence := "收入到"
+	before := te.ExtractTags(sentence, -1)
+	te.GetIdf().SetMedian(6)
+	if median := te.GetIdf().Median(); median != 6 {
+		t.Fatalf("got median %f, expected 6", median)
+	}
+	after := te.ExtractTags(sentence, -1)
+	if len(after) != 2 || len(before) != 2 {
+		t.Fatalf("got %v and %v, expected 收入 and 到", before, after)
+	}
+	weights := make(map[string]float64)
+	for _, tag := range before {
+		weights[tag.text] = tag.weight
+	}
+	for _, tag := range after {
+		expected := weights[tag.text]
+		if tag.text == "到" {
+			expected *= 2
+		}
+		if math.Abs(tag.weight-expected) > 1e-6 {
+			t.Fatalf("got %v, expected weight %f", tag, expected)
+		}
+	}
+}
+
+func TestNewIdfFromMap(t *testing.T) {
+	freqs := map[string]float64{"收入": 1, "增长": 3, "其他": 5, "利润": 2}
+	idf := NewIdfFromMap(freqs)
+	loaded := NewIdf()
+	loaded.loadDictionaryReader(strings.NewReader("收入 1\n增长 3\n其他 5\n利润 2\n"))
+	if idf.Median() != loaded.Median() {
+		t.Fatalf("got median %f, expected %f", idf.Median(), loaded.Median())
+	}
+	for word, freq := range freqs {
+		if f, ok := idf.Frequency(word); !ok || f != freq {
+			t.Fatalf("got IDF %f for %s, expected %f", f, word, freq)
+		}
+	}
+
+	idf.Build(map[string]float64{"收入": 7})
+	if _, ok := idf.Frequency("增长"); ok {
+		t.Fatal("增长 should be removed by Build")
+	}
+	if idf.Median() != 7 {
+		t.Fatalf("got median %f, expected 7", idf.Median())
+	}
+	if NewIdfFromMap(nil).Median() != 0 {
+		t.Fatal("empty Idf should have zero median")
+	}
+}
+
+func TestIdfRecompute(t *testing.T) {
+	i := NewIdfFromMap(map[string]float64{"北京": 5})
+	i.AddDocument([]string{"我", "爱", "北京", "北京"})
+	i.AddDocument([]string{"我", "爱", "上海"})
+	i.AddDocument([]string{"我", "去", "上海"})
+	i.AddDocument([]string{"我"})
+	if freq, _ := i.Frequency("北京"); freq != 5 {
+		t.Fatalf("got IDF %f for 北京 before Recompute, expected 5", freq)
+	}
+	i.Recompute()
+	expected := map[string]float64{
+		"我":  0,
+		"爱":  math.Log(2),
+		"上海": math.Log(2),
+		"北京": math.Log(4),
+		"去":  math.Log(4),
+	}
+	for word, idf := range expected {
+		if freq, ok := i.Frequency(word); !ok || math.Abs(freq-idf) > 1e-9 {
+			t.Fatalf("got IDF %f for %s, expected %f", freq, word, idf)
+		}
+	}
+	if median := i.Median(); math.Abs(median-math.Log(2)) > 1e-9 {
+		t.Fatalf("got median %f, expected %f", median, math.Log(2))
+	}
+}
+
+func TestIdfRange(t *testing.T) {
+	i := NewIdfFromMap(map[string]float64{"增长": 3, "收入": 1, "其他": 5})
+	if n := i.Len(); n != 3 {
+		t.Fatalf("got length %d, expected 3", n)
+	}
+	var words []string
+	i.Range(func(word string, idf float64) bool {
+		if freq, _ := i.Frequency(word); freq != idf {
+			t.Fatalf("got IDF %f for %s, expected %f", idf, word, freq)
+		}
+		words = append(words, word)
+		return len(words) < 2
+	})
+	if len(words) != 2 || words[0] != "其他" || words[1] != "增长" {
+		t.Fatalf("got %q, expected the first two words in order", words)
+	}
+}
+
+func TestIdfLoadCRLF(t *testing.T) {
+	i := NewIdf()
+	if err := i.loadDictionaryReader(strings.NewReader("\ufeff收入 1.5\r\n增长 3\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if freq, ok := i.Frequency("收入"); !ok || freq != 1.5 {
+		t.Fatalf("got IDF %f for 收入, expected 1.5", freq)
+	}
+	if n := i.Len(); n != 2 {
+		t.Fatalf("got %d words, expected 2", n)
+	}
+}
@@ -0,0 +1,18 @@
+package analyse
+
+import "strings"
+
+// NGrams joins every n consecutive words into one n-gram, for example the
+// bigrams of "机器学习", "模型", "训练" are "机器学习模型" and "模型训练".
+// An empty slice is returned if n is not positive or larger than the number
+// of words.
+func NGrams(words []string, n int) []string {
+	if n <= 0 || n > len(words) {
+		return []string{}
+	}
+	grams := make([]string, 0, len(words)-n+1)
+	for i := 0; i+n <= len(words); i++ {
+		grams = append(grams, strings.Join(words[i:i+n], ""))
+	}
+	return grams
+}
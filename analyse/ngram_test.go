@@ -0,0 +1,29 @@
+package analyse
+
+import "testing"
+
+func TestNGrams(t *testing.T) {
+	words := []string{"机器学习", "模型", "训练"}
+	tests := []struct {
+		n        int
+		expected []string
+	}{
+		{1, []string{"机器学习", "模型", "训练"}},
+		{2, []string{"机器学习模型", "模型训练"}},
+		{3, []string{"机器学习模型训练"}},
+		{4, []string{}},
+		{0, []string{}},
+		{-1, []string{}},
+	}
+	for _, test := range tests {
+		grams := NGrams(words, test.n)
+		if grams == nil || len(grams) != len(test.expected) {
+			t.Fatalf("got %v for n = %d, expected %v", grams, test.n, test.expected)
+		}
+		for i := range grams {
+			if grams[i] != test.expected[i] {
+				t.Fatalf("got %v for n = %d, expected %v", grams, test.n, test.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package analyse
+
+import "math"
+
+// Similarity returns the cosine similarity, in [0, 1], of the TF-IDF vectors
+// of texts a and b, i.e. the weights of all their key words extracted by t.
+// It returns 0 if either text has no key words, e.g. it is empty.
+func Similarity(a, b string, t *TagExtracter) float64 {
+	va := t.ExtractTags(a, ExtractAll)
+	vb := t.ExtractTags(b, ExtractAll)
+	weights := make(map[string]float64, len(va))
+	normA := 0.0
+	for _, s := range va {
+		weights[s.text] = s.weight
+		normA += s.weight * s.weight
+	}
+	dot, normB := 0.0, 0.0
+	for _, s := range vb {
+		dot += weights[s.text] * s.weight
+		normB += s.weight * s.weight
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return math.Max(0, math.Min(1, dot/math.Sqrt(normA*normB)))
+}
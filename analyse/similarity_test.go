@@ -0,0 +1,31 @@
+package analyse
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	te := newTestTagExtracter("机器 100 n\n学习 100 v\n模型 100 n\n天气 100 n\n晴朗 100 a\n",
+		"机器 2\n学习 2\n模型 3\n天气 4\n晴朗 5\n")
+	for _, c := range []struct {
+		a, b     string
+		expected float64
+	}{
+		{"机器学习模型", "机器学习模型", 1},
+		{"机器学习模型", "天气晴朗", 0},
+		{"", "机器学习模型", 0},
+		{"   ", "", 0},
+	} {
+		if s := Similarity(c.a, c.b, te); math.Abs(s-c.expected) > 1e-9 {
+			t.Fatalf("%q and %q: got similarity %f, expected %f", c.a, c.b, s, c.expected)
+		}
+	}
+	s := Similarity("机器学习模型", "机器学习", te)
+	if s <= 0 || s >= 1 {
+		t.Fatalf("got similarity %f, expected in (0, 1)", s)
+	}
+	if r := Similarity("机器学习", "机器学习模型", te); math.Abs(r-s) > 1e-9 {
+		t.Fatalf("got similarity %f and %f, expected symmetric", s, r)
+	}
+}
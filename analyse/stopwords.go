@@ -1,6 +1,10 @@
 package analyse
 
 import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/kricen/jiebago/dictionary"
@@ -44,36 +48,113 @@ var DefaultStopWordMap = map[string]int{
 // StopWord is a thread-safe dictionary for all stop words.
 type StopWord struct {
 	stopWordMap map[string]int
+	// patterns holds the patterns added by AddPattern.
+	patterns []*regexp.Regexp
 	sync.RWMutex
+
+	// CaseSensitive disables lower case normalization of both stop words and
+	// queried words, it should be set before any stop word is added. The
+	// normalization is only used for matching, extracted tags always keep
+	// their original case.
+	CaseSensitive bool
+}
+
+func (s *StopWord) key(word string) string {
+	if s.CaseSensitive {
+		return word
+	}
+	return strings.ToLower(word)
 }
 
 // AddToken adds a token into StopWord dictionary.
 func (s *StopWord) AddToken(token dictionary.Token) {
-	s.Lock()
-	s.stopWordMap[token.Text()] = 1
-	s.Unlock()
+	s.Add(token.Text())
 }
 
 // NewStopWord create a new StopWord with default stop words.
 func NewStopWord() *StopWord {
 	s := new(StopWord)
-	s.stopWordMap = DefaultStopWordMap
+	s.stopWordMap = make(map[string]int, len(DefaultStopWordMap))
+	for word := range DefaultStopWordMap {
+		s.stopWordMap[word] = 1
+	}
 	return s
 }
 
-// IsStopWord checks if a given word is stop word.
-func (s *StopWord) IsStopWord(word string) bool {
+// Add adds a word into StopWord dictionary.
+func (s *StopWord) Add(word string) {
+	s.Lock()
+	if s.stopWordMap == nil {
+		s.stopWordMap = make(map[string]int)
+	}
+	s.stopWordMap[s.key(word)] = 1
+	s.Unlock()
+}
+
+// Remove removes a word from StopWord dictionary.
+func (s *StopWord) Remove(word string) {
+	s.Lock()
+	delete(s.stopWordMap, s.key(word))
+	s.Unlock()
+}
+
+// Contains checks if a given word is in StopWord dictionary, the check is case
+// insensitive unless CaseSensitive is set.
+func (s *StopWord) Contains(word string) bool {
 	s.RLock()
-	_, ok := s.stopWordMap[word]
+	_, ok := s.stopWordMap[s.key(word)]
 	s.RUnlock()
 	return ok
 }
 
+// AddPattern adds a pattern of stop words, every word matching it is a stop
+// word, e.g. `^\d+$` for all numbers. The pattern is matched against the word
+// as it is, regardless of CaseSensitive, use the flag (?i) for case
+// insensitive patterns.
+func (s *StopWord) AddPattern(re *regexp.Regexp) {
+	s.Lock()
+	s.patterns = append(s.patterns, re)
+	s.Unlock()
+}
+
+// IsStopWord checks if a given word is stop word, that is it is in StopWord
+// dictionary like Contains checks, or it matches any pattern added by
+// AddPattern. The patterns are only tried if the word is not in the
+// dictionary.
+func (s *StopWord) IsStopWord(word string) bool {
+	if s.Contains(word) {
+		return true
+	}
+	s.RLock()
+	defer s.RUnlock()
+	for _, re := range s.patterns {
+		if re.MatchString(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Words returns all the stop words in sorted order.
+func (s *StopWord) Words() []string {
+	s.RLock()
+	words := make([]string, 0, len(s.stopWordMap))
+	for word := range s.stopWordMap {
+		words = append(words, word)
+	}
+	s.RUnlock()
+	sort.Strings(words)
+	return words
+}
+
 // Load loads all tokens from given channel into StopWord dictionary.
 func (s *StopWord) Load(ch <-chan dictionary.Token) {
 	s.Lock()
+	if s.stopWordMap == nil {
+		s.stopWordMap = make(map[string]int)
+	}
 	for token := range ch {
-		s.stopWordMap[token.Text()] = 1
+		s.stopWordMap[s.key(token.Text())] = 1
 	}
 	s.Unlock()
 }
@@ -81,3 +162,20 @@ func (s *StopWord) Load(ch <-chan dictionary.Token) {
 func (s *StopWord) loadDictionary(fileName string) error {
 	return dictionary.LoadStopwords(s, fileName)
 }
+
+func (s *StopWord) loadDictionaryReader(r io.Reader) error {
+	return dictionary.LoadStopwordsReader(s, r)
+}
+
+// LoadAndMerge reads stop words from the given file, one word per line, and
+// adds them to the existing ones instead of replacing them, so that several
+// stop word lists can be combined.
+func (s *StopWord) LoadAndMerge(fileName string) error {
+	return s.loadDictionary(fileName)
+}
+
+// LoadAndMergeReader reads stop words from the given reader and adds them to
+// the existing ones, see LoadAndMerge.
+func (s *StopWord) LoadAndMergeReader(r io.Reader) error {
+	return s.loadDictionaryReader(r)
+}
@@ -0,0 +1,103 @@
+package analyse
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStopWord(t *testing.T) {
+	s := NewStopWord()
+	if !s.Contains("the") || !s.IsStopWord("the") {
+		t.Fatal("the should be a default stop word")
+	}
+	s.Add("我们")
+	if !s.Contains("我们") {
+		t.Fatal("我们 should be a stop word after Add")
+	}
+	s.Remove("the")
+	if s.Contains("the") {
+		t.Fatal("the should not be a stop word after Remove")
+	}
+	if _, ok := DefaultStopWordMap["the"]; !ok {
+		t.Fatal("Remove should not change DefaultStopWordMap")
+	}
+	if _, ok := DefaultStopWordMap["我们"]; ok {
+		t.Fatal("Add should not change DefaultStopWordMap")
+	}
+	words := s.Words()
+	if len(words) != len(DefaultStopWordMap) {
+		t.Fatalf("got %d stop words, expected %d", len(words), len(DefaultStopWordMap))
+	}
+	for i := 1; i < len(words); i++ {
+		if words[i-1] >= words[i] {
+			t.Fatalf("stop words %v are not sorted", words)
+		}
+	}
+
+	var zero StopWord
+	zero.Add("的")
+	if !zero.Contains("的") || len(zero.Words()) != 1 {
+		t.Fatalf("got stop words %v, expected [的]", zero.Words())
+	}
+}
+
+func TestStopWordCaseInsensitive(t *testing.T) {
+	s := NewStopWord()
+	for _, word := range []string{"The", "THE", "the"} {
+		if !s.IsStopWord(word) {
+			t.Fatalf("%s should be a stop word", word)
+		}
+	}
+	s.Add("Python")
+	if !s.Contains("python") || !s.Contains("PYTHON") {
+		t.Fatal("Python should be matched case insensitively")
+	}
+
+	cs := &StopWord{CaseSensitive: true}
+	cs.Add("the")
+	if !cs.Contains("the") || cs.Contains("The") || cs.Contains("THE") {
+		t.Fatal("only the should be a stop word when CaseSensitive is set")
+	}
+}
+
+func TestStopWordLoadAndMerge(t *testing.T) {
+	s := NewStopWord()
+	if err := s.LoadAndMergeReader(strings.NewReader("的\n了\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadAndMerge("stop_words.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadAndMergeReader(strings.NewReader("噪音\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"the", "的", "了", "噪音"} {
+		if !s.Contains(word) {
+			t.Fatalf("%s should be kept after merging", word)
+		}
+	}
+	if err := s.LoadAndMerge("no_such_file.txt"); err == nil {
+		t.Fatal("expected an error for missing file")
+	}
+}
+
+func TestStopWordPattern(t *testing.T) {
+	s := NewStopWord()
+	s.AddPattern(regexp.MustCompile(`^\d+$`))
+	for _, word := range []string{"2023", "7", "the"} {
+		if !s.IsStopWord(word) {
+			t.Fatalf("%s should be a stop word", word)
+		}
+	}
+	if s.IsStopWord("A100") || s.Contains("2023") {
+		t.Fatal("only numbers should match the pattern, and Contains should ignore patterns")
+	}
+
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n", "北京 1\n天安门 2\n")
+	te.GetStopWord().AddPattern(regexp.MustCompile(`^\d+$`))
+	tags := te.ExtractTags("北京2023天安门，天安门12", ExtractAll)
+	if len(tags) != 2 || tags[0].Text() != "天安门" || tags[1].Text() != "北京" {
+		t.Fatalf("got %v, expected numbers filtered", tags)
+	}
+}
@@ -2,12 +2,27 @@
 package analyse
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/kricen/jiebago"
+	"github.com/kricen/jiebago/util"
+)
+
+var (
+	reNum = regexp.MustCompile(`^[\.[:digit:]]+$`)
+	reEng = regexp.MustCompile(`[[:alnum:]]`)
 )
 
 // Segment represents a word with weight.
@@ -16,6 +31,12 @@ type Segment struct {
 	weight float64
 }
 
+// NewSegment creates a segment with the given text and weight, for example
+// in the function passed to Segments.Map.
+func NewSegment(text string, weight float64) Segment {
+	return Segment{text: text, weight: weight}
+}
+
 // Text returns the segment's text.
 func (s Segment) Text() string {
 	return s.text
@@ -26,13 +47,79 @@ func (s Segment) Weight() float64 {
 	return s.weight
 }
 
+type segmentJSON struct {
+	Text   string  `json:"text"`
+	Weight float64 `json:"weight"`
+}
+
+// MarshalJSON implements json.Marshaler, a Segment is encoded as
+// {"text": text, "weight": weight}.
+func (s Segment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(segmentJSON{Text: s.text, Weight: s.weight})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Segment) UnmarshalJSON(data []byte) error {
+	var sj segmentJSON
+	if err := json.Unmarshal(data, &sj); err != nil {
+		return err
+	}
+	s.text, s.weight = sj.Text, sj.Weight
+	return nil
+}
+
 // Segments represents a slice of Segment.
 type Segments []Segment
 
+// ExtractAll could be passed as topK to return all the candidate segments.
+const ExtractAll = -1
+
+// top returns the first topK segments, all the segments are returned if topK
+// is negative.
+func (ss Segments) top(topK int) Segments {
+	if topK >= 0 && len(ss) > topK {
+		return ss[:topK]
+	}
+	return ss
+}
+
+// Filter returns the segments for which pred returns true, in the same
+// order, ss is not modified.
+func (ss Segments) Filter(pred func(Segment) bool) Segments {
+	result := make(Segments, 0, len(ss))
+	for _, s := range ss {
+		if pred(s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Map returns the segments returned by fn for every segment, in the same
+// order, ss is not modified.
+func (ss Segments) Map(fn func(Segment) Segment) Segments {
+	result := make(Segments, len(ss))
+	for i, s := range ss {
+		result[i] = fn(s)
+	}
+	return result
+}
+
+// Texts returns the texts of the segments, in the same order.
+func (ss Segments) Texts() []string {
+	texts := make([]string, len(ss))
+	for i, s := range ss {
+		texts[i] = s.text
+	}
+	return texts
+}
+
 func (ss Segments) Len() int {
 	return len(ss)
 }
 
+// Less orders segments by weight, segments with the same weight are ordered
+// by text, so that sort.Reverse(ss) puts them in descending text order.
 func (ss Segments) Less(i, j int) bool {
 	if ss[i].weight == ss[j].weight {
 		return ss[i].text < ss[j].text
@@ -45,13 +132,238 @@ func (ss Segments) Swap(i, j int) {
 	ss[i], ss[j] = ss[j], ss[i]
 }
 
-// TagExtracter is used to extract tags from sentence.
+// TieBreak decides the order of segments with the same weight in
+// SortSegments.
+type TieBreak int
+
+const (
+	// TieBreakStable keeps segments with the same weight in their original
+	// order.
+	TieBreakStable TieBreak = iota
+	// TieBreakText orders segments with the same weight by ascending text.
+	TieBreakText
+)
+
+// SortSegments sorts ss by descending weight in place, segments with the
+// same weight are ordered according to tieBreak.
+func SortSegments(ss Segments, tieBreak TieBreak) {
+	sort.SliceStable(ss, func(i, j int) bool {
+		if ss[i].weight == ss[j].weight && tieBreak == TieBreakText {
+			return ss[i].text < ss[j].text
+		}
+		return ss[i].weight > ss[j].weight
+	})
+}
+
+// WeightedSample returns n distinct segments of ss drawn at random without
+// replacement, the probability of drawing a segment is proportional to its
+// weight, segments with non-positive weights are never drawn. The segments
+// are returned in the order they are drawn, all the segments with positive
+// weights are returned if there are no more than n of them. A nil r uses
+// the default source of math/rand, pass a seeded r for reproducible results.
+func (ss Segments) WeightedSample(n int, r *rand.Rand) Segments {
+	random := rand.Float64
+	if r != nil {
+		random = r.Float64
+	}
+	pool := make(Segments, 0, len(ss))
+	total := 0.0
+	for _, s := range ss {
+		if s.weight > 0 {
+			pool = append(pool, s)
+			total += s.weight
+		}
+	}
+	result := Segments{}
+	for len(result) < n && len(pool) > 0 {
+		x := random() * total
+		i := 0
+		for ; i < len(pool)-1; i++ {
+			x -= pool[i].weight
+			if x < 0 {
+				break
+			}
+		}
+		result = append(result, pool[i])
+		total -= pool[i].weight
+		pool = append(pool[:i], pool[i+1:]...)
+	}
+	return result
+}
+
+const defaultMinWordLen = 2
+
+// WeightFunc computes the weight of a word from its raw term frequency tf,
+// its IDF and the document length docLen, which is the number of all
+// candidate words in the document.
+type WeightFunc func(tf, idf, docLen float64) float64
+
+// TFIDF is the default WeightFunc, it returns tf / docLen * idf.
+func TFIDF(tf, idf, docLen float64) float64 {
+	return idf * (tf / docLen)
+}
+
+/*
+TagExtracter is used to extract tags from sentence.
+
+A dictionary must be loaded by LoadDictionary and an IDF dictionary by LoadIdf
+or SetIdf before extracting tags, otherwise the extracting methods panic with
+a message telling which one is missing. Without stop words loaded, no word is
+treated as a stop word.
+
+A TagExtracter keeps no per-document state, every extracting method counts
+the words of its own input from scratch, so the same TagExtracter could be
+reused for any number of documents, see Reset.
+*/
 type TagExtracter struct {
 	seg      *jiebago.Segmenter
 	idf      *Idf
 	stopWord *StopWord
+	// idfs holds the IDF dictionaries registered by RegisterIdf.
+	idfs map[string]*Idf
+	// wordWeights holds the multipliers set by SetWordWeight.
+	wordWeights map[string]float64
+	// allowed holds the words added by AllowWord.
+	allowed map[string]struct{}
+
+	// MinWordLen is the minimum number of runes of a tag, shorter words are
+	// dropped. Zero means the default value 2.
+	MinWordLen int
+	// KeepSingleChars lists single runes kept as candidates regardless of
+	// MinWordLen, e.g. "茶" and "酒" for a food domain, while the other
+	// single runes like "的" are still dropped. They are still filtered by
+	// stop words.
+	KeepSingleChars map[string]bool
+	// MinTermFreq is the minimum raw term frequency of a tag, rarer words are
+	// dropped before weighting, which reduces the noise of one-off words in
+	// long documents. They still count in the document length. Zero means
+	// the default value 1, which keeps all the words.
+	MinTermFreq int
+	// WeightFunc computes the weight of every candidate word, TFIDF is used
+	// if it is nil.
+	WeightFunc WeightFunc
+	// Normalize divides the weights of the tags extracted by ExtractTags and
+	// the other ExtractTags* methods by the maximum weight, so that the top
+	// tag weights 1.0. Otherwise the raw weights computed by WeightFunc are
+	// returned, which are idf * tf / docLen for TFIDF, where tf is the count
+	// of the word and docLen is the count of all the candidate words.
+	Normalize bool
+	// LengthBoost multiplies the weight of every candidate word by
+	// 1 + LengthBoost*(runeLen-2), so that longer words are preferred. Zero
+	// means no boost.
+	LengthBoost float64
+	// UseFullMode cuts sentences with full mode, like CutAll, instead of
+	// accurate mode in ExtractTags, ExtractTagsWithPOS, ExtractTagsWithIdf and
+	// ExtractTagsReader, which finds more candidates in ambiguous text.
+	// Overlapping occurrences of the same word are counted once.
+	UseFullMode bool
+	// KeepAlphaNum keeps all the numbers in CNExtractTags, which keeps only
+	// the first number by default. Codes made of digits and letters, e.g.
+	// "A100", are always kept, and so are all the numbers in the other
+	// extracting methods.
+	KeepAlphaNum bool
+	// Canonicalize maps every cutted word to its canonical form before
+	// counting, so that variants like "伺服器" and "服务器", or "Server" and
+	// "server", are counted as one word. The stop words, IDF, POS and word
+	// weights are looked up with the canonical form, and the tags are
+	// returned in the canonical form. Nil keeps words as they are.
+	Canonicalize func(word string) string
+}
+
+const (
+	errNoDictionary = "analyse: dictionary not loaded, call LoadDictionary first"
+	errNoIdf        = "analyse: IDF not loaded, call LoadIdf first"
+)
+
+// segmenter returns the segmenter, it panics if no dictionary is loaded.
+func (t *TagExtracter) segmenter() *jiebago.Segmenter {
+	if t.seg == nil {
+		panic(errNoDictionary)
+	}
+	return t.seg
+}
+
+func (t *TagExtracter) weight(tf, idf, docLen float64) float64 {
+	if t.WeightFunc != nil {
+		return t.WeightFunc(tf, idf, docLen)
+	}
+	return TFIDF(tf, idf, docLen)
+}
+
+// boost applies LengthBoost and the multiplier set by SetWordWeight to the
+// weight of w.
+func (t *TagExtracter) boost(w string, weight float64) float64 {
+	if m, ok := t.wordWeights[w]; ok {
+		weight *= m
+	}
+	if t.LengthBoost == 0 {
+		return weight
+	}
+	return weight * (1 + t.LengthBoost*float64(utf8.RuneCountInString(w)-2))
+}
+
+// blocked reports whether w is blacklisted by a zero multiplier.
+func (t *TagExtracter) blocked(w string) bool {
+	m, ok := t.wordWeights[w]
+	return ok && m == 0
 }
 
+// SetWordWeight sets a multiplier of the computed weight of word in
+// ExtractTags and the other ExtractTags* methods and CNExtractTags, e.g. 2 to
+// boost brand names or 0.5 to suppress boilerplate, regardless of its IDF.
+// A multiplier of 0 drops the word from the results. The multipliers should
+// not be changed while extracting tags.
+func (t *TagExtracter) SetWordWeight(word string, multiplier float64) {
+	if t.wordWeights == nil {
+		t.wordWeights = make(map[string]float64)
+	}
+	t.wordWeights[word] = multiplier
+}
+
+// AllowWord adds word to the allowlist, allowlisted words are never dropped
+// as stop words, even if they are in the stop word dictionary. It is useful
+// when a shared stop word list is too strict for a specific context. The
+// allowlist should not be changed while extracting tags.
+func (t *TagExtracter) AllowWord(word string) {
+	if t.allowed == nil {
+		t.allowed = make(map[string]struct{})
+	}
+	t.allowed[word] = struct{}{}
+}
+
+// isCandidate reports whether w is long enough or kept by KeepSingleChars,
+// and either allowlisted or not a stop word.
+func (t *TagExtracter) isCandidate(w string) bool {
+	minWordLen := t.minWordLen()
+	if t.KeepSingleChars[w] && utf8.RuneCountInString(w) == 1 {
+		minWordLen = 1
+	}
+	if _, ok := t.allowed[w]; ok {
+		return utf8.RuneCountInString(w) >= minWordLen
+	}
+	return isCandidate(w, minWordLen, t.stopWord)
+}
+
+func (t *TagExtracter) minTermFreq() float64 {
+	if t.MinTermFreq > 1 {
+		return float64(t.MinTermFreq)
+	}
+	return 1
+}
+
+func (t *TagExtracter) minWordLen() int {
+	if t.MinWordLen > 0 {
+		return t.MinWordLen
+	}
+	return defaultMinWordLen
+}
+
+// Reset clears the per-document state of t, so that it could be reused for
+// another document. Since no extracting method keeps per-document state, it
+// is a no-op for now, it is safe to call at any time. The dictionaries, stop
+// words and options are kept.
+func (t *TagExtracter) Reset() {}
+
 // LoadDictionary reads the given filename and create a new dictionary.
 func (t *TagExtracter) LoadDictionary(fileName string) error {
 	t.stopWord = NewStopWord()
@@ -59,10 +371,22 @@ func (t *TagExtracter) LoadDictionary(fileName string) error {
 	return t.seg.LoadDictionary(fileName)
 }
 
+// LoadDictionaryReader reads dictionary from the given reader and create a new
+// dictionary.
+func (t *TagExtracter) LoadDictionaryReader(r io.Reader) error {
+	t.stopWord = NewStopWord()
+	t.seg = new(jiebago.Segmenter)
+	return t.seg.LoadDictionaryReader(r)
+}
+
 func (t *TagExtracter) GetSegmenter() *jiebago.Segmenter {
 	return t.seg
 }
 
+func (t *TagExtracter) GetIdf() *Idf {
+	return t.idf
+}
+
 func (t *TagExtracter) GetStopWord() *StopWord {
 	return t.stopWord
 }
@@ -73,54 +397,487 @@ func (t *TagExtracter) LoadIdf(fileName string) error {
 	return t.idf.loadDictionary(fileName)
 }
 
+// LoadIdfReader reads IDF dictionary from the given reader and create a new
+// Idf dictionary.
+func (t *TagExtracter) LoadIdfReader(r io.Reader) error {
+	t.idf = NewIdf()
+	return t.idf.loadDictionaryReader(r)
+}
+
+// SetIdf replaces the Idf dictionary, for example with one created by
+// NewIdfFromMap.
+func (t *TagExtracter) SetIdf(idf *Idf) {
+	t.idf = idf
+}
+
+// RegisterIdf reads the given file as an IDF dictionary under the given name,
+// it can be used by ExtractTagsWithIdf to switch IDF dictionaries per call
+// while sharing the same segmenter. A previously registered one with the same
+// name is replaced.
+func (t *TagExtracter) RegisterIdf(name string, fileName string) error {
+	idf := NewIdf()
+	if err := idf.loadDictionary(fileName); err != nil {
+		return err
+	}
+	if t.idfs == nil {
+		t.idfs = make(map[string]*Idf)
+	}
+	t.idfs[name] = idf
+	return nil
+}
+
+// namedIdf returns the IDF dictionary registered as name, or the one loaded
+// by LoadIdf if there is no such one.
+func (t *TagExtracter) namedIdf(name string) *Idf {
+	if idf, ok := t.idfs[name]; ok {
+		return idf
+	}
+	return t.idf
+}
+
+// isBlank reports whether s is empty or contains only white space.
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
 // LoadStopWords reads the given file and create a new StopWord dictionary.
 func (t *TagExtracter) LoadStopWords(fileName string) error {
 	t.stopWord = NewStopWord()
 	return t.stopWord.loadDictionary(fileName)
 }
 
-// ExtractTags extracts the topK key words from sentence.
+// LoadAll loads the dictionary, the IDF dictionary and the stop words from
+// the given files, like LoadDictionary, LoadIdf and LoadStopWords do in turn.
+// It stops at the first error, which tells the file failed to load.
+func (t *TagExtracter) LoadAll(dictFile, idfFile, stopFile string) error {
+	if err := t.LoadDictionary(dictFile); err != nil {
+		return fmt.Errorf("analyse: dictionary %s: %v", dictFile, err)
+	}
+	if err := t.LoadIdf(idfFile); err != nil {
+		return fmt.Errorf("analyse: IDF %s: %v", idfFile, err)
+	}
+	if err := t.LoadStopWords(stopFile); err != nil {
+		return fmt.Errorf("analyse: stop words %s: %v", stopFile, err)
+	}
+	return nil
+}
+
+// LoadAllReaders loads the dictionary, the IDF dictionary and the stop words
+// from the given readers like LoadAll, for example from embedded data.
+func (t *TagExtracter) LoadAllReaders(dict, idf, stop io.Reader) error {
+	if err := t.LoadDictionaryReader(dict); err != nil {
+		return fmt.Errorf("analyse: dictionary: %v", err)
+	}
+	if err := t.LoadIdfReader(idf); err != nil {
+		return fmt.Errorf("analyse: IDF: %v", err)
+	}
+	stopWord := NewStopWord()
+	if err := stopWord.loadDictionaryReader(stop); err != nil {
+		return fmt.Errorf("analyse: stop words: %v", err)
+	}
+	t.stopWord = stopWord
+	return nil
+}
+
+// ExtractTags extracts the topK key words from sentence, sorted by weight.
+// If topK is ExtractAll or any other negative value, all candidate segments
+// are returned; if topK is 0, an empty result is returned. An empty or
+// whitespace-only sentence returns an empty result without being cutted.
+// The candidates are collected in text order and sorted stably, tags with
+// the same weight are ordered by descending text, see Segments.Less, so the
+// result is the same in every run, and so is the result of the other
+// extracting methods. Use SortSegments to reorder them.
 func (t *TagExtracter) ExtractTags(sentence string, topK int) (tags Segments) {
+	return t.ExtractTagsWithPOS(sentence, topK, nil)
+}
+
+/*
+ExtractTagsWithPOS extracts the topK key words from sentence, only words whose
+POS is in allowPOS are kept. If allowPOS is empty, it acts the same as
+ExtractTags. Parameter topK has the same meaning as in ExtractTags.
+
+The POS of a word is looked up in the segmenter's dictionary, which uses the
+ICTCLAS tag set, for example:
+
+	n: noun, nr: person name, ns: place name, nt: organization, nz: other proper noun
+	v: verb, vn: verbal noun, vd: adverbial verb
+	a: adjective, ad: adverbial adjective, an: adjectival noun
+	d: adverb, i: idiom, j: abbreviation, l: fixed expression
+	m: numeral, q: quantifier, r: pronoun, t: time word
+
+Words not found in the dictionary are tagged "m" if they are numbers, "eng"
+if they contain letters or digits, and "x" otherwise, this means new words
+found by the Hidden Markov Model are tagged "x".
+*/
+func (t *TagExtracter) ExtractTagsWithPOS(sentence string, topK int, allowPOS []string) (tags Segments) {
+	if isBlank(sentence) {
+		return Segments{}
+	}
+	freqMap := make(map[string]float64)
+	t.count(sentence, posFilter(allowPOS), freqMap)
+	return t.rank(t.idf, freqMap, topK)
+}
+
+// ExtractTagsWithIdf extracts the topK key words from sentence like
+// ExtractTags, but weights them with the IDF dictionary registered as idfName
+// by RegisterIdf. The one loaded by LoadIdf is used if idfName is unknown.
+func (t *TagExtracter) ExtractTagsWithIdf(sentence string, topK int, idfName string) (tags Segments) {
+	if isBlank(sentence) {
+		return Segments{}
+	}
+	freqMap := make(map[string]float64)
+	t.count(sentence, nil, freqMap)
+	return t.rank(t.namedIdf(idfName), freqMap, topK)
+}
+
+// ExtractTagsFromWords extracts the topK key words from already cutted words,
+// only the stop words filtering, term frequency counting and weighting are
+// done. ExtractTags(sentence, topK) is the same as cutting sentence with
+// GetSegmenter().Cut(sentence, true) and passing the words to it.
+func (t *TagExtracter) ExtractTagsFromWords(words []string, topK int) Segments {
+	freqMap := make(map[string]float64)
+	for _, w := range words {
+		t.countWord(w, nil, freqMap)
+	}
+	return t.rank(t.idf, freqMap, topK)
+}
+
+/*
+ExtractKeyphrases extracts the topK key phrases from sentence, e.g.
+"深度学习框架" made of "深度", "学习" and "框架". Every candidate word of
+ExtractTags is weighted the same way first, then every maximal run of
+adjacent candidate words in sentence is joined into one phrase, which weights
+the sum of the weights of its words, so that a phrase always outranks each of
+its words. Stop words, short words, punctuations and spaces split phrases, a
+single candidate word between them is a phrase by itself. If Normalize is
+set, the weights are divided by the maximum phrase weight.
+*/
+func (t *TagExtracter) ExtractKeyphrases(sentence string, topK int) Segments {
+	if isBlank(sentence) {
+		return Segments{}
+	}
+	var words []string
 	freqMap := make(map[string]float64)
+	for w := range t.segmenter().Cut(sentence, true) {
+		words = append(words, w)
+		t.countWord(w, nil, freqMap)
+	}
+	weights := make(map[string]float64, len(freqMap))
+	for _, s := range t.rank(t.idf, freqMap, ExtractAll) {
+		weights[s.text] = s.weight
+	}
+
+	phrases := make(map[string]float64)
+	var phrase strings.Builder
+	weight := 0.0
+	flush := func() {
+		if phrase.Len() > 0 {
+			phrases[phrase.String()] = weight
+			phrase.Reset()
+			weight = 0.0
+		}
+	}
+	for _, w := range words {
+		w = t.term(w)
+		if wt, ok := weights[w]; ok {
+			phrase.WriteString(w)
+			weight += wt
+		} else {
+			flush()
+		}
+	}
+	flush()
+
+	ws := make(Segments, 0, len(phrases))
+	for _, text := range sortedKeys(phrases) {
+		ws = append(ws, Segment{text: text, weight: phrases[text]})
+	}
+	sort.Stable(sort.Reverse(ws))
+	if t.Normalize && len(ws) > 0 && ws[0].weight > 0 {
+		max := ws[0].weight
+		for i := range ws {
+			ws[i].weight /= max
+		}
+	}
+	return ws.top(topK)
+}
+
+// ExtractTagsBatch extracts the topK key words from every sentence like
+// ExtractTags, on several goroutines. Every sentence is an independent
+// document, tags[i] holds the tags of sentences[i]. If workers is not
+// positive, runtime.NumCPU() is used.
+func (t *TagExtracter) ExtractTagsBatch(sentences []string, topK int, workers int) []Segments {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	tags := make([]Segments, len(sentences))
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range tasks {
+				tags[index] = t.ExtractTags(sentences[index], topK)
+			}
+		}()
+	}
+	for index := range sentences {
+		tasks <- index
+	}
+	close(tasks)
+	wg.Wait()
+	return tags
+}
+
+// ExtractTagsReader extracts the topK key words from all the text read from
+// r, like ExtractTags does. The text is cutted sentence by sentence, so that
+// only the term frequencies are kept in memory.
+func (t *TagExtracter) ExtractTagsReader(r io.Reader, topK int) (Segments, error) {
+	freqMap := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	scanner.Split(jiebago.ScanSentences)
+	for scanner.Scan() {
+		t.count(scanner.Text(), nil, freqMap)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t.rank(t.idf, freqMap, topK), nil
+}
+
+func posFilter(allowPOS []string) map[string]int {
+	if len(allowPOS) == 0 {
+		return nil
+	}
+	posFilt := make(map[string]int)
+	for _, pos := range allowPOS {
+		posFilt[pos] = 1
+	}
+	return posFilt
+}
+
+// isCandidate reports whether w is long enough and not a stop word, a nil
+// stop means no stop words.
+func isCandidate(w string, minWordLen int, stop *StopWord) bool {
+	if utf8.RuneCountInString(w) < minWordLen {
+		return false
+	}
+	return stop == nil || !stop.IsStopWord(w)
+}
 
-	for w := range t.seg.Cut(sentence, true) {
+// WordFrequency cuts sentence with seg and returns the raw count of every
+// word, words are filtered by length and stop words the same way as
+// ExtractTags does with the default MinWordLen.
+func WordFrequency(seg *jiebago.Segmenter, sentence string, stop *StopWord) map[string]int {
+	counts := make(map[string]int)
+	for w := range seg.Cut(sentence, true) {
 		w = strings.TrimSpace(w)
-		if utf8.RuneCountInString(w) < 2 {
-			continue
+		if isCandidate(w, defaultMinWordLen, stop) {
+			counts[w]++
 		}
-		if t.stopWord.IsStopWord(w) {
-			continue
+	}
+	return counts
+}
+
+// count adds the term frequencies of all candidate words in sentence into
+// freqMap, a nil posFilt allows all POS.
+func (t *TagExtracter) count(sentence string, posFilt map[string]int, freqMap map[string]float64) {
+	if t.UseFullMode {
+		ends := make(map[string]int)
+		for _, token := range t.segmenter().Tokenize(sentence, jiebago.FullMode, false) {
+			if end, ok := ends[token.Text]; ok && token.Start < end {
+				continue
+			}
+			ends[token.Text] = token.End
+			t.countWord(token.Text, posFilt, freqMap)
 		}
-		if f, ok := freqMap[w]; ok {
-			freqMap[w] = f + 1.0
-		} else {
-			freqMap[w] = 1.0
+		return
+	}
+	for w := range t.segmenter().Cut(sentence, true) {
+		t.countWord(w, posFilt, freqMap)
+	}
+}
+
+// term returns the trimmed canonical form of w, see Canonicalize.
+func (t *TagExtracter) term(w string) string {
+	w = strings.TrimSpace(w)
+	if t.Canonicalize != nil {
+		return t.Canonicalize(w)
+	}
+	return w
+}
+
+// countWord adds one to the term frequency of w in freqMap if w is a
+// candidate word.
+func (t *TagExtracter) countWord(w string, posFilt map[string]int, freqMap map[string]float64) {
+	w = t.term(w)
+	if !t.isCandidate(w) {
+		return
+	}
+	if posFilt != nil {
+		if _, ok := posFilt[t.pos(w)]; !ok {
+			return
 		}
 	}
+	if f, ok := freqMap[w]; ok {
+		freqMap[w] = f + 1.0
+	} else {
+		freqMap[w] = 1.0
+	}
+}
+
+// sortedKeys returns the keys of m in ascending order, so that ranking does
+// not depend on the map iteration order.
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rank weights all the words in freqMap with idf and returns the topK of them.
+func (t *TagExtracter) rank(idf *Idf, freqMap map[string]float64, topK int) Segments {
+	if idf == nil {
+		panic(errNoIdf)
+	}
 	total := 0.0
 	for _, freq := range freqMap {
 		total += freq
 	}
-	for k, v := range freqMap {
-		freqMap[k] = v / total
-	}
 	ws := make(Segments, 0)
 	var s Segment
-	for k, v := range freqMap {
-		if freq, ok := t.idf.Frequency(k); ok {
-			s = Segment{text: k, weight: freq * v}
+	for _, k := range sortedKeys(freqMap) {
+		v := freqMap[k]
+		if t.blocked(k) || v < t.minTermFreq() {
+			continue
+		}
+		if freq, ok := idf.Frequency(k); ok {
+			s = Segment{text: k, weight: t.boost(k, t.weight(v, freq, total))}
 		} else {
-			s = Segment{text: k, weight: t.idf.median * v}
+			s = Segment{text: k, weight: t.boost(k, t.weight(v, idf.Median(), total))}
 		}
 		ws = append(ws, s)
 	}
 	sort.Sort(sort.Reverse(ws))
-	if topK >= 0 && len(ws) > topK {
-		tags = ws[:topK]
-	} else {
-		tags = ws
+	if t.Normalize && len(ws) > 0 && ws[0].weight > 0 {
+		max := ws[0].weight
+		for i := range ws {
+			ws[i].weight /= max
+		}
 	}
-	return tags
+	return ws.top(topK)
+}
+
+// PositionedTag is a tag with its weight and all its occurrences in the text.
+type PositionedTag struct {
+	Text   string
+	Weight float64
+	// Positions holds the rune offsets [start, end) of every occurrence.
+	Positions [][2]int
+}
+
+// ExtractTagsWithPositions extracts the topK key words from sentence like
+// ExtractTags, together with the rune offsets of all their occurrences in
+// sentence, both are computed in one pass of cutting.
+func (t *TagExtracter) ExtractTagsWithPositions(sentence string, topK int) []PositionedTag {
+	if isBlank(sentence) {
+		return []PositionedTag{}
+	}
+	freqMap := make(map[string]float64)
+	positions := make(map[string][][2]int)
+	for _, token := range t.segmenter().Tokenize(sentence, jiebago.DefaultMode, true) {
+		w := t.term(token.Text)
+		t.countWord(token.Text, nil, freqMap)
+		if _, ok := freqMap[w]; ok {
+			positions[w] = append(positions[w], [2]int{token.Start, token.End})
+		}
+	}
+	tags := t.rank(t.idf, freqMap, topK)
+	result := make([]PositionedTag, len(tags))
+	for i, tag := range tags {
+		result[i] = PositionedTag{Text: tag.text, Weight: tag.weight, Positions: positions[tag.text]}
+	}
+	return result
+}
+
+// DetailedTag is a tag with the components of its weight.
+type DetailedTag struct {
+	Text string
+	// TF is the number of occurrences of the tag in the text.
+	TF float64
+	// IDF is the IDF of the tag, or the median IDF if it is not found in the
+	// IDF dictionary.
+	IDF float64
+	// Weight is the final weight returned by ExtractTags for the tag, after
+	// LengthBoost, SetWordWeight and Normalize are applied, so it equals
+	// WeightFunc(TF, IDF, docLen) only if none of them is set.
+	Weight float64
+}
+
+// ExtractTagsDetailed extracts the topK key words from sentence like
+// ExtractTags, together with the term frequency and IDF of every tag, which
+// explains why it is a key word.
+func (t *TagExtracter) ExtractTagsDetailed(sentence string, topK int) []DetailedTag {
+	if isBlank(sentence) {
+		return []DetailedTag{}
+	}
+	freqMap := make(map[string]float64)
+	t.count(sentence, nil, freqMap)
+	tags := t.rank(t.idf, freqMap, topK)
+	result := make([]DetailedTag, len(tags))
+	for i, tag := range tags {
+		idf, ok := t.idf.Frequency(tag.text)
+		if !ok {
+			idf = t.idf.Median()
+		}
+		result[i] = DetailedTag{Text: tag.text, TF: freqMap[tag.text], IDF: idf, Weight: tag.weight}
+	}
+	return result
+}
+
+// Highlight cuts text into words and surrounds every word found in tags with
+// left and right, for example "<b>" and "</b>". Words are matched by their
+// canonical forms if Canonicalize is set. All the other text is kept
+// verbatim, including whitespaces.
+func (t *TagExtracter) Highlight(text string, tags Segments, left, right string) string {
+	words := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		words[tag.text] = true
+	}
+	runes := []rune(text)
+	var buf bytes.Buffer
+	end := 0
+	for _, token := range t.segmenter().Tokenize(text, jiebago.DefaultMode, true) {
+		// the text between tokens, e.g. whitespaces dropped by TrimTokens
+		buf.WriteString(string(runes[end:token.Start]))
+		word := string(runes[token.Start:token.End])
+		if words[t.term(token.Text)] {
+			buf.WriteString(left)
+			buf.WriteString(word)
+			buf.WriteString(right)
+		} else {
+			buf.WriteString(word)
+		}
+		end = token.End
+	}
+	buf.WriteString(string(runes[end:]))
+	return buf.String()
+}
+
+func (t *TagExtracter) pos(w string) string {
+	if pos, ok := t.segmenter().Pos(w); ok {
+		return pos
+	}
+	switch {
+	case reNum.MatchString(w):
+		return "m"
+	case reEng.MatchString(w):
+		return "eng"
+	}
+	return "x"
 }
 
 func (t *TagExtracter) isDigit(w string) bool {
@@ -141,6 +898,7 @@ func (t *TagExtracter) isPureDigitLetters(str string) bool {
 	}
 	d, l := false, false
 	for _, r := range str {
+		r = util.HalfWidth(r)
 		if unicode.IsNumber(r) {
 			d = true
 			continue
@@ -157,58 +915,76 @@ func (t *TagExtracter) isPureDigitLetters(str string) bool {
 	return false
 }
 
-// CnExtractTags extracts the topK key words from sentence.
+// CNExtractTags extracts the topK key words found in the IDF dictionary from
+// sentence, it also returns all the candidate words in order. Parameter topK
+// has the same meaning as in ExtractTags. Unless KeepAlphaNum is set, only
+// the first number is kept.
 func (t *TagExtracter) CNExtractTags(sentence string, topK int) (tags Segments, words []string) {
+	if isBlank(sentence) {
+		return Segments{}, []string{}
+	}
+	if t.idf == nil {
+		panic(errNoIdf)
+	}
 	freqMap := make(map[string]float64)
 
 	numCount := 0
-	for w := range t.seg.Cut(sentence, true) {
-		w = strings.TrimSpace(w)
-		if utf8.RuneCountInString(w) < 2 {
-			continue
-		}
-		if t.stopWord.IsStopWord(w) {
+	for w := range t.segmenter().Cut(sentence, true) {
+		w = t.term(w)
+		if !t.isCandidate(w) {
 			continue
 		}
 
-		if t.isDigit(w) {
-			numCount++
-			if numCount > 0 {
-				continue
+		if !t.KeepAlphaNum {
+			// keeps only the first numeric word
+			if t.isDigit(w) {
+				numCount++
+				if numCount > 1 {
+					continue
+				}
 			}
 		}
-
 		words = append(words, w)
-		if _, ok := freqMap[w]; ok {
-			freqMap[w] = 1.0
+		if f, ok := freqMap[w]; ok {
+			freqMap[w] = f + 1.0
 		} else {
 			freqMap[w] = 1.0
 		}
 	}
-	/*
-		total := 0.0
-		for _, freq := range freqMap {
-			total += freq
-		}
-		for k, v := range freqMap {
-			freqMap[k] = v / total
-		}
-	*/
+	total := 0.0
+	for _, freq := range freqMap {
+		total += freq
+	}
 	ws := make(Segments, 0)
 	var s Segment
-	for k, v := range freqMap {
+	for _, k := range sortedKeys(freqMap) {
+		v := freqMap[k]
+		if t.blocked(k) || v < t.minTermFreq() {
+			continue
+		}
 		if freq, ok := t.idf.Frequency(k); ok {
-			s = Segment{text: k, weight: freq * v}
+			s = Segment{text: k, weight: t.boost(k, t.weight(v, freq, total))}
 		} else {
 			continue
 		}
 		ws = append(ws, s)
 	}
 	sort.Sort(sort.Reverse(ws))
-	if topK >= 0 && len(ws) > topK {
-		tags = ws[:topK]
-	} else {
-		tags = ws
-	}
+	tags = ws.top(topK)
 	return tags, words
 }
+
+// CNResult is the result of CNExtractTagsResult.
+type CNResult struct {
+	// Tags are the ranked key words found in the IDF dictionary.
+	Tags Segments
+	// Words are all the kept candidate words in order of appearance.
+	Words []string
+}
+
+// CNExtractTagsResult is the same as CNExtractTags, but returns the tags and
+// words together in a CNResult.
+func (t *TagExtracter) CNExtractTagsResult(sentence string, topK int) CNResult {
+	tags, words := t.CNExtractTags(sentence, topK)
+	return CNResult{Tags: tags, Words: words}
+}
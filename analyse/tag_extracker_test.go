@@ -1,7 +1,12 @@
 package analyse
 
 import (
+	"encoding/json"
 	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -298,3 +303,869 @@ func TestExtractTagsWithStopWordsFile(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractTagsWithPOS(t *testing.T) {
+	var te TagExtracter
+	te.LoadDictionary("../dict.txt")
+	te.GetSegmenter().LoadUserDictionary("../userdict.txt")
+	te.LoadIdf("idf.txt")
+
+	sentence := "李小福是创新办主任也是云计算方面的专家"
+	result := te.ExtractTagsWithPOS(sentence, -1, []string{"nr", "i"})
+	if len(result) != 2 {
+		t.Fatalf("%s = %v, expected 2 tags", sentence, result)
+	}
+	for _, tag := range result {
+		if tag.text != "李小福" && tag.text != "创新办" {
+			t.Fatalf("unexpected tag %v", tag)
+		}
+	}
+
+	expected := te.ExtractTags(sentence, -1)
+	result = te.ExtractTagsWithPOS(sentence, -1, nil)
+	if len(result) != len(expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+	for index, tag := range result {
+		if tag != expected[index] {
+			t.Fatalf("%v != %v", tag, expected[index])
+		}
+	}
+}
+
+func newTestTagExtracter(dict, idf string) *TagExtracter {
+	te := new(TagExtracter)
+	te.LoadDictionaryReader(strings.NewReader(dict))
+	te.LoadIdfReader(strings.NewReader(idf))
+	return te
+}
+
+func TestCNExtractTagsNumbers(t *testing.T) {
+	te := newTestTagExtracter("收入 100 n\n增长 100 v\n", "收入 5\n增长 5\n2023 5\n15 5\n200 5\n")
+	tags, words := te.CNExtractTags("2023年 收入 增长 15% 到 200亿", -1)
+	expected := []string{"2023", "收入", "增长"}
+	if len(words) != len(expected) {
+		t.Fatalf("got words %v, expected %v", words, expected)
+	}
+	for i, w := range words {
+		if w != expected[i] {
+			t.Fatalf("got words %v, expected %v", words, expected)
+		}
+	}
+	if len(tags) != len(expected) {
+		t.Fatalf("got tags %v, expected %d tags", tags, len(expected))
+	}
+}
+
+func TestCNExtractTagsFrequency(t *testing.T) {
+	te := newTestTagExtracter("收入 100 n\n增长 100 v\n", "收入 5\n增长 5\n")
+	tags, _ := te.CNExtractTags("收入，增长，收入，收入", -1)
+	if len(tags) != 2 {
+		t.Fatalf("got tags %v, expected 2 tags", tags)
+	}
+	if tags[0].text != "收入" || tags[1].text != "增长" {
+		t.Fatalf("got tags %v, expected 收入 ranks above 增长", tags)
+	}
+	if math.Abs(tags[0].weight-5*0.75) > 1e-6 || math.Abs(tags[1].weight-5*0.25) > 1e-6 {
+		t.Fatalf("got tags %v, expected weights 3.75 and 1.25", tags)
+	}
+}
+
+func TestExtractTagsMinWordLen(t *testing.T) {
+	te := newTestTagExtracter("收入 100 n\n增长 100 v\n增长率 100 n\n", "收入 5\n增长率 5\n亿 5\n")
+	sentence := "收入增长率到亿"
+	tests := []struct {
+		minWordLen int
+		expected   []string
+	}{
+		{0, []string{"增长率", "收入"}},
+		{1, []string{"亿", "到", "增长率", "收入"}},
+		{3, []string{"增长率"}},
+	}
+	for _, test := range tests {
+		te.MinWordLen = test.minWordLen
+		result := te.ExtractTags(sentence, -1)
+		if len(result) != len(test.expected) {
+			t.Fatalf("MinWordLen %d got %v, expected %v", test.minWordLen, result, test.expected)
+		}
+		texts := make(map[string]bool)
+		for _, tag := range result {
+			texts[tag.text] = true
+		}
+		for _, text := range test.expected {
+			if !texts[text] {
+				t.Fatalf("MinWordLen %d got %v, expected %v", test.minWordLen, result, test.expected)
+			}
+		}
+
+		tags, words := te.CNExtractTags(sentence, -1)
+		for _, w := range words {
+			if len([]rune(w)) < te.minWordLen() {
+				t.Fatalf("MinWordLen %d should drop word %s", test.minWordLen, w)
+			}
+		}
+		if len(tags) > len(test.expected) {
+			t.Fatalf("MinWordLen %d got tags %v", test.minWordLen, tags)
+		}
+	}
+}
+
+func TestExtractTagsTopK(t *testing.T) {
+	var te TagExtracter
+	te.LoadDictionary("../dict.txt")
+	te.LoadIdf("idf.txt")
+	all := te.ExtractTags(Lyric, ExtractAll)
+	tests := []struct {
+		topK     int
+		expected int
+	}{
+		{ExtractAll, len(all)},
+		{-2, len(all)},
+		{0, 0},
+		{3, 3},
+		{10000, len(all)},
+	}
+	for _, test := range tests {
+		result := te.ExtractTags(Lyric, test.topK)
+		if len(result) != test.expected {
+			t.Fatalf("topK %d got %d tags, expected %d", test.topK, len(result), test.expected)
+		}
+		for i, tag := range result {
+			if tag != all[i] {
+				t.Fatalf("topK %d got %v at %d, expected %v", test.topK, tag, i, all[i])
+			}
+		}
+	}
+}
+
+func TestExtractTagsWeightFunc(t *testing.T) {
+	te := newTestTagExtracter("收入 100 n\n增长 100 v\n", "收入 2\n增长 3\n")
+	sentence := "收入，增长，收入"
+	result := te.ExtractTags(sentence, -1)
+	if len(result) != 2 || result[0].text != "收入" || math.Abs(result[0].weight-2*2.0/3) > 1e-6 {
+		t.Fatalf("got %v, expected default TFIDF weights", result)
+	}
+
+	te.WeightFunc = func(tf, idf, docLen float64) float64 {
+		if docLen != 3 {
+			t.Fatalf("got docLen %f, expected 3", docLen)
+		}
+		return idf - tf
+	}
+	result = te.ExtractTags(sentence, -1)
+	if len(result) != 2 || result[0].text != "增长" || result[0].weight != 2 || result[1].weight != 0 {
+		t.Fatalf("got %v, expected weights from WeightFunc", result)
+	}
+}
+
+func TestIsPureDigitLetters(t *testing.T) {
+	var te TagExtracter
+	for _, word := range []string{"A100", "rtx4090", "Ａ１００", "ＲＴＸ4090"} {
+		if !te.isPureDigitLetters(word) {
+			t.Fatalf("%s should be pure digit letters", word)
+		}
+	}
+	for _, word := range []string{"", "100", "ABC", "ＡＢＣ", "A股100"} {
+		if te.isPureDigitLetters(word) {
+			t.Fatalf("%s should not be pure digit letters", word)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	te := newTestTagExtracter("收入 100 n\n增长 100 v\n", "收入 5\n增长 5\n")
+	tags := Segments{Segment{text: "收入", weight: 1}, Segment{text: "增长", weight: 0.5}}
+	text := "今年 收入增长，\n收入  不错"
+	expected := "今年 <b>收入</b><b>增长</b>，\n<b>收入</b>  不错"
+	if result := te.Highlight(text, tags, "<b>", "</b>"); result != expected {
+		t.Fatalf("got %q, expected %q", result, expected)
+	}
+	if result := te.Highlight(text, nil, "<b>", "</b>"); result != text {
+		t.Fatalf("got %q, expected %q", result, text)
+	}
+	te.GetSegmenter().TrimTokens = true
+	if result := te.Highlight(text, tags, "<b>", "</b>"); result != expected {
+		t.Fatalf("got %q with TrimTokens, expected %q", result, expected)
+	}
+}
+
+func TestPackageHighlight(t *testing.T) {
+	tags := Segments{NewSegment("golang", 1), NewSegment("go", 1)}
+	text := "golang  and go,\ngolang"
+	expected := "<b>golang</b>  and <b>go</b>,\n<b>golang</b>"
+	if result := Highlight(text, tags, "<b>", "</b>"); result != expected {
+		t.Fatalf("got %q, expected %q", result, expected)
+	}
+	if result := Highlight(text, nil, "<b>", "</b>"); result != text {
+		t.Fatalf("got %q, expected %q", result, text)
+	}
+}
+
+func TestCNExtractTagsResult(t *testing.T) {
+	te := newTestTagExtracter("收入 100 n\n增长 100 v\n", "收入 5\n")
+	sentence := "收入，增长，收入"
+	tags, words := te.CNExtractTags(sentence, -1)
+	result := te.CNExtractTagsResult(sentence, -1)
+	if len(result.Tags) != len(tags) || len(result.Words) != len(words) {
+		t.Fatalf("got %v, expected %v and %v", result, tags, words)
+	}
+	for i, tag := range result.Tags {
+		if tag != tags[i] {
+			t.Fatalf("got %v, expected %v", result.Tags, tags)
+		}
+	}
+	for i, word := range result.Words {
+		if word != words[i] {
+			t.Fatalf("got %v, expected %v", result.Words, words)
+		}
+	}
+}
+
+func TestCNExtractTagsKeepAlphaNum(t *testing.T) {
+	te := newTestTagExtracter("显卡 100 n\n", "显卡 5\nA100 5\nRTX4090 5\n2023 5\n15 5\n")
+	sentence := "2023 显卡 A100 RTX4090 15"
+	_, words := te.CNExtractTags(sentence, -1)
+	expected := []string{"2023", "显卡", "A100", "RTX4090"}
+	if len(words) != len(expected) {
+		t.Fatalf("got words %v, expected %v", words, expected)
+	}
+	for i, w := range words {
+		if w != expected[i] {
+			t.Fatalf("got words %v, expected %v", words, expected)
+		}
+	}
+	if tags := te.ExtractTags(sentence, -1); len(tags) != 5 {
+		t.Fatalf("got %v, expected all the numbers and codes kept by ExtractTags", tags)
+	}
+
+	te.KeepAlphaNum = true
+	tags, words := te.CNExtractTags(sentence, -1)
+	expected = []string{"2023", "显卡", "A100", "RTX4090", "15"}
+	if len(words) != len(expected) || len(tags) != len(expected) {
+		t.Fatalf("got words %v and tags %v, expected %v", words, tags, expected)
+	}
+	for i, w := range words {
+		if w != expected[i] {
+			t.Fatalf("got words %v, expected %v", words, expected)
+		}
+	}
+}
+
+func TestExtractTagsReader(t *testing.T) {
+	var te TagExtracter
+	te.LoadDictionary("../dict.txt")
+	te.LoadIdf("idf.txt")
+	expected := te.ExtractTags(Lyric, 10)
+	result, err := te.ExtractTagsReader(strings.NewReader(Lyric), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("got %v, expected %v", result, expected)
+	}
+	for i, tag := range result {
+		if tag.text != expected[i].text || math.Abs(tag.weight-expected[i].weight) > 1e-9 {
+			t.Fatalf("got %v, expected %v", tag, expected[i])
+		}
+	}
+}
+
+func TestSegmentsJSON(t *testing.T) {
+	ss := Segments{Segment{text: "吉林", weight: 1}, Segment{text: "欧亚", weight: 0.5}}
+	data, err := json.Marshal(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"text":"吉林","weight":1},{"text":"欧亚","weight":0.5}]`
+	if string(data) != expected {
+		t.Fatalf("got %s, expected %s", data, expected)
+	}
+	var result Segments
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != len(ss) || result[0] != ss[0] || result[1] != ss[1] {
+		t.Fatalf("got %v, expected %v", result, ss)
+	}
+}
+
+func TestNewTagExtracterDefault(t *testing.T) {
+	te, err := NewTagExtracterDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := te.GetSegmenter().Frequency("AT&T"); !ok {
+		t.Fatal("AT&T should be in the bundled dictionary")
+	}
+	if _, ok := te.GetIdf().Frequency("劳动防护"); !ok {
+		t.Fatal("劳动防护 should be in the bundled IDF")
+	}
+	if !te.GetStopWord().IsStopWord("the") {
+		t.Fatal("the should be a bundled stop word")
+	}
+}
+
+func TestExtractTagsWithIdf(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n", "北京 1\n天安门 10\n")
+	fileName := filepath.Join(t.TempDir(), "news.txt")
+	if err := os.WriteFile(fileName, []byte("北京 10\n天安门 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := te.RegisterIdf("news", fileName); err != nil {
+		t.Fatal(err)
+	}
+	sentence := "北京 天安门"
+	for _, c := range []struct {
+		idfName, expected string
+	}{
+		{"news", "北京"},
+		{"", "天安门"},
+		{"unknown", "天安门"},
+	} {
+		tags := te.ExtractTagsWithIdf(sentence, 1, c.idfName)
+		if len(tags) != 1 || tags[0].Text() != c.expected {
+			t.Fatalf("got %v with IDF %q, expected %s", tags, c.idfName, c.expected)
+		}
+	}
+	if tags := te.ExtractTags(sentence, 1); len(tags) != 1 || tags[0].Text() != "天安门" {
+		t.Fatalf("got %v, ExtractTags should use the IDF loaded by LoadIdf", tags)
+	}
+}
+
+func TestWordFrequency(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n我 100 r\n爱 100 v\n", "北京 1\n天安门 10\n")
+	te.GetStopWord().Add("天安门")
+	sentence := "我爱北京，我爱北京天安门"
+	counts := WordFrequency(te.GetSegmenter(), sentence, te.GetStopWord())
+	if len(counts) != 1 || counts["北京"] != 2 {
+		t.Fatalf("got %v, expected map[北京:2]", counts)
+	}
+	tags := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != len(counts) || tags[0].Text() != "北京" {
+		t.Fatalf("got tags %v, expected the same words as %v", tags, counts)
+	}
+	if counts := WordFrequency(te.GetSegmenter(), sentence, nil); counts["天安门"] != 1 {
+		t.Fatalf("got %v, nil stop words should keep 天安门", counts)
+	}
+}
+
+func TestAllowWord(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n我 100 r\n爱 100 v\n", "北京 1\n天安门 10\n")
+	te.GetStopWord().Add("天安门")
+	te.GetStopWord().Add("北京")
+	te.AllowWord("天安门")
+	sentence := "我爱北京，我爱北京天安门"
+	tags := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != 1 || tags[0].Text() != "天安门" {
+		t.Fatalf("got %v, expected only the allowlisted 天安门", tags)
+	}
+	if tags, _ := te.CNExtractTags(sentence, ExtractAll); len(tags) != 1 || tags[0].Text() != "天安门" {
+		t.Fatalf("got %v, expected only the allowlisted 天安门", tags)
+	}
+	if !te.GetStopWord().IsStopWord("天安门") {
+		t.Fatal("AllowWord should not change the stop words")
+	}
+}
+
+func TestExtractTagsFromWords(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n我 100 r\n爱 100 v\n", "北京 1\n天安门 10\n")
+	sentence := "我爱北京，我爱北京天安门"
+	expected := te.ExtractTags(sentence, ExtractAll)
+	tags := te.ExtractTagsFromWords(te.GetSegmenter().CutToSlice(sentence, true), ExtractAll)
+	if len(tags) != len(expected) {
+		t.Fatalf("got %v, expected %v", tags, expected)
+	}
+	for i := range tags {
+		if tags[i] != expected[i] {
+			t.Fatalf("got %v, expected %v", tags, expected)
+		}
+	}
+}
+
+func TestExtractTagsWithPositions(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n我 100 r\n爱 100 v\n", "北京 10\n天安门 1\n")
+	sentence := "我爱北京，我爱北京天安门"
+	tags := te.ExtractTagsWithPositions(sentence, ExtractAll)
+	expected := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != len(expected) {
+		t.Fatalf("got %v, expected the same tags as %v", tags, expected)
+	}
+	for i, tag := range tags {
+		if tag.Text != expected[i].Text() || tag.Weight != expected[i].Weight() {
+			t.Fatalf("got %v, expected the same tags as %v", tags, expected)
+		}
+	}
+	runes := []rune(sentence)
+	positions := map[string][][2]int{"北京": {{2, 4}, {7, 9}}, "天安门": {{9, 12}}}
+	for _, tag := range tags {
+		if len(tag.Positions) != len(positions[tag.Text]) {
+			t.Fatalf("got positions %v for %s, expected %v", tag.Positions, tag.Text, positions[tag.Text])
+		}
+		for i, p := range tag.Positions {
+			if p != positions[tag.Text][i] || string(runes[p[0]:p[1]]) != tag.Text {
+				t.Fatalf("got positions %v for %s, expected %v", tag.Positions, tag.Text, positions[tag.Text])
+			}
+		}
+	}
+}
+
+func TestExtractTagsNormalize(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n我 100 r\n爱 100 v\n", "北京 2\n天安门 10\n")
+	sentence := "我爱北京，我爱北京天安门"
+	raw := te.ExtractTags(sentence, ExtractAll)
+	// 天安门: 10 * 1 / 3, 北京: 2 * 2 / 3
+	if len(raw) != 2 || math.Abs(raw[0].Weight()-10.0/3) > 1e-9 || math.Abs(raw[1].Weight()-4.0/3) > 1e-9 {
+		t.Fatalf("got raw weights %v", raw)
+	}
+	te.Normalize = true
+	tags := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != 2 || tags[0].Weight() != 1.0 || math.Abs(tags[1].Weight()-0.4) > 1e-9 {
+		t.Fatalf("got normalized weights %v", tags)
+	}
+}
+
+func TestExtractTagsUseFullMode(t *testing.T) {
+	te := newTestTagExtracter("清华 100\n清华大学 100\n大学 100\n哈哈 100\n", "清华 5\n清华大学 5\n大学 5\n哈哈 5\n")
+	if tags := te.ExtractTags("清华大学", ExtractAll); len(tags) != 1 {
+		t.Fatalf("got %v, expected only 清华大学 in accurate mode", tags)
+	}
+	te.UseFullMode = true
+	tags := te.ExtractTags("清华大学", ExtractAll)
+	if len(tags) != 3 {
+		t.Fatalf("got %v, expected 清华, 清华大学 and 大学 in full mode", tags)
+	}
+	// Full mode finds "哈哈" at 0, 1 and 2, only the ones at 0 and 2 are
+	// counted, the same as accurate mode does.
+	te.UseFullMode = false
+	expected := te.ExtractTags("哈哈哈哈大学", ExtractAll)
+	te.UseFullMode = true
+	tags = te.ExtractTags("哈哈哈哈大学", ExtractAll)
+	if len(tags) != len(expected) {
+		t.Fatalf("got %v, expected %v", tags, expected)
+	}
+	for i := range tags {
+		if tags[i] != expected[i] {
+			t.Fatalf("got %v, expected %v", tags, expected)
+		}
+	}
+}
+
+func TestExtractTagsNotLoaded(t *testing.T) {
+	expectPanic := func(message string, f func()) {
+		defer func() {
+			if r := recover(); r != message {
+				t.Fatalf("got panic %v, expected %q", r, message)
+			}
+		}()
+		f()
+	}
+	var te TagExtracter
+	expectPanic(errNoDictionary, func() { te.ExtractTags("我爱北京", 5) })
+	te.LoadDictionaryReader(strings.NewReader("北京 100 ns\n"))
+	expectPanic(errNoIdf, func() { te.ExtractTags("我爱北京", 5) })
+	expectPanic(errNoIdf, func() { te.CNExtractTags("我爱北京", 5) })
+
+	var empty TagExtracter
+	empty.seg = te.GetSegmenter()
+	empty.SetIdf(NewIdfFromMap(map[string]float64{"北京": 1}))
+	if tags := empty.ExtractTags("我爱北京", 5); len(tags) != 1 || tags[0].Text() != "北京" {
+		t.Fatalf("got %v, expected [北京] without stop words", tags)
+	}
+	expectPanic(errNoDictionary, func() { new(TextRankExtracter).ExtractTags("我爱北京", 5) })
+}
+
+func TestExtractTagsLengthBoost(t *testing.T) {
+	te := newTestTagExtracter("人工智能 100 n\n智能 100 n\n发展 100 v\n", "人工智能 9\n智能 10\n")
+	sentence := "人工智能发展，智能"
+	if tags := te.ExtractTags(sentence, 1); len(tags) != 1 || tags[0].Text() != "智能" {
+		t.Fatalf("got %v, expected 智能 without length boost", tags)
+	}
+	te.LengthBoost = 0.5
+	tags := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) == 0 || tags[0].Text() != "人工智能" {
+		t.Fatalf("got %v, expected 人工智能 with length boost", tags)
+	}
+	for _, tag := range tags {
+		if tag.Text() == "智能" && tag.Weight() != te.weight(1, 10, 3) {
+			t.Fatalf("got weight %f for 智能, two runes words should not be boosted", tag.Weight())
+		}
+	}
+}
+
+func TestSetWordWeight(t *testing.T) {
+	te := newTestTagExtracter("人工智能 100 n\n智能 100 n\n发展 100 v\n", "人工智能 9\n智能 10\n发展 8\n")
+	sentence := "人工智能发展，智能"
+	te.SetWordWeight("人工智能", 2)
+	te.SetWordWeight("智能", 0)
+	tags := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != 2 || tags[0].Text() != "人工智能" || tags[1].Text() != "发展" {
+		t.Fatalf("got %v, expected 人工智能 and 发展", tags)
+	}
+	if tags[0].Weight() != 2*te.weight(1, 9, 3) {
+		t.Fatalf("got weight %f for 人工智能, expected it doubled", tags[0].Weight())
+	}
+	if tags, _ := te.CNExtractTags(sentence, ExtractAll); len(tags) != 2 || tags[0].Text() != "人工智能" {
+		t.Fatalf("got %v, expected 人工智能 and 发展", tags)
+	}
+}
+
+func TestExtractKeyphrases(t *testing.T) {
+	te := newTestTagExtracter("深度 100 n\n学习 100 v\n框架 100 n\n我们 100 r\n使用 100 v\n的 100 u\n",
+		"深度 5\n学习 4\n框架 6\n使用 2\n")
+	te.GetStopWord().Add("我们")
+	tags := te.ExtractKeyphrases("我们使用的深度学习框架，深度", ExtractAll)
+	weights := make(map[string]float64)
+	for _, tag := range te.ExtractTags("我们使用的深度学习框架，深度", ExtractAll) {
+		weights[tag.Text()] = tag.Weight()
+	}
+	expected := []string{"深度学习框架", "深度", "使用"}
+	if len(tags) != len(expected) {
+		t.Fatalf("got %v, expected %q", tags, expected)
+	}
+	for i, tag := range tags {
+		if tag.Text() != expected[i] {
+			t.Fatalf("got %v, expected %q", tags, expected)
+		}
+	}
+	if sum := weights["深度"] + weights["学习"] + weights["框架"]; math.Abs(tags[0].Weight()-sum) > 1e-9 {
+		t.Fatalf("got weight %f for 深度学习框架, expected the sum %f", tags[0].Weight(), sum)
+	}
+	if tags := te.ExtractKeyphrases(" ", 5); tags == nil || len(tags) != 0 {
+		t.Fatalf("got %v, expected an empty result", tags)
+	}
+}
+
+func TestExtractTagsDetailed(t *testing.T) {
+	te := newTestTagExtracter("收入 100 n\n增长 100 v\n利润 100 n\n", "收入 2\n增长 3\n")
+	sentence := "收入增长，收入，利润"
+	tags := te.ExtractTagsDetailed(sentence, ExtractAll)
+	expected := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != len(expected) {
+		t.Fatalf("got %v, expected %v", tags, expected)
+	}
+	for i, tag := range tags {
+		if tag.Text != expected[i].Text() || tag.Weight != expected[i].Weight() {
+			t.Fatalf("got %v, expected %v", tags, expected)
+		}
+		if w := TFIDF(tag.TF, tag.IDF, 4); math.Abs(w-tag.Weight) > 1e-9 {
+			t.Fatalf("got %v, expected weight %f from TF and IDF", tag, w)
+		}
+	}
+	for _, tag := range tags {
+		switch {
+		case tag.Text == "收入" && (tag.TF != 2 || tag.IDF != 2):
+			t.Fatalf("got %v, expected TF 2 and IDF 2", tag)
+		case tag.Text == "利润" && (tag.TF != 1 || tag.IDF != te.GetIdf().Median()):
+			t.Fatalf("got %v, expected TF 1 and the median IDF", tag)
+		}
+	}
+
+	te.LengthBoost = 0.5
+	te.Normalize = true
+	te.SetWordWeight("利润", 3)
+	tags = te.ExtractTagsDetailed(sentence, ExtractAll)
+	expected = te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != len(expected) || tags[0].Weight != 1 {
+		t.Fatalf("got %v, expected %v normalized", tags, expected)
+	}
+	for i, tag := range tags {
+		if tag.Text != expected[i].Text() || tag.Weight != expected[i].Weight() {
+			t.Fatalf("got %v, expected %v", tags, expected)
+		}
+	}
+}
+
+func TestSortSegments(t *testing.T) {
+	ss := Segments{{"b", 1}, {"c", 2}, {"a", 1}, {"d", 1}}
+	for _, c := range []struct {
+		tieBreak TieBreak
+		expected []string
+	}{
+		{TieBreakStable, []string{"c", "b", "a", "d"}},
+		{TieBreakText, []string{"c", "a", "b", "d"}},
+	} {
+		sorted := append(Segments(nil), ss...)
+		SortSegments(sorted, c.tieBreak)
+		for i, s := range sorted {
+			if s.Text() != c.expected[i] {
+				t.Fatalf("got %v with tie break %d, expected %v", sorted, c.tieBreak, c.expected)
+			}
+		}
+	}
+}
+
+func TestSegmentsHelpers(t *testing.T) {
+	ss := Segments{{"北京", 0.5}, {"天安门", 0.05}, {"故宫", 0.2}}
+	kept := ss.Filter(func(s Segment) bool { return s.Weight() > 0.1 })
+	if len(kept) != 2 || kept[0].Text() != "北京" || kept[1].Text() != "故宫" {
+		t.Fatalf("got %v, expected 北京 and 故宫", kept)
+	}
+	doubled := ss.Map(func(s Segment) Segment { return NewSegment(s.Text(), s.Weight()*2) })
+	for i := range ss {
+		if doubled[i].Text() != ss[i].Text() || doubled[i].Weight() != ss[i].Weight()*2 {
+			t.Fatalf("got %v, expected the weights of %v doubled", doubled, ss)
+		}
+	}
+	texts := ss.Texts()
+	if len(texts) != 3 || texts[0] != "北京" || texts[1] != "天安门" || texts[2] != "故宫" {
+		t.Fatalf("got %q, expected [北京 天安门 故宫]", texts)
+	}
+	if texts := (Segments{}).Texts(); texts == nil || len(texts) != 0 {
+		t.Fatalf("got %q, expected an empty slice", texts)
+	}
+}
+
+func TestWeightedSample(t *testing.T) {
+	ss := Segments{{"a", 1}, {"b", 0}, {"c", 8}, {"d", 1}}
+	counts := make(map[string]int)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		sample := ss.WeightedSample(2, r)
+		if len(sample) != 2 || sample[0].Text() == sample[1].Text() {
+			t.Fatalf("got %v, expected 2 distinct segments", sample)
+		}
+		counts[ss.WeightedSample(1, r)[0].Text()]++
+	}
+	if counts["b"] != 0 {
+		t.Fatalf("got %v, segment with zero weight should never be drawn", counts)
+	}
+	// c weighs 80% of the total
+	if counts["c"] < 750 || counts["c"] > 850 {
+		t.Fatalf("got %v, expected c drawn about 800 times", counts)
+	}
+	a := ss.WeightedSample(2, rand.New(rand.NewSource(7)))
+	b := ss.WeightedSample(2, rand.New(rand.NewSource(7)))
+	if a[0] != b[0] || a[1] != b[1] {
+		t.Fatalf("got %v and %v with the same seed", a, b)
+	}
+	if sample := ss.WeightedSample(10, r); len(sample) != 3 {
+		t.Fatalf("got %v, expected all the 3 segments with positive weights", sample)
+	}
+	if sample := ss.WeightedSample(0, r); len(sample) != 0 {
+		t.Fatalf("got %v, expected none", sample)
+	}
+}
+
+func TestExtractTagsBatch(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n我 100 r\n爱 100 v\n", "北京 2\n天安门 10\n")
+	sentences := []string{"我爱北京", "我爱北京天安门", "", "天安门，北京，天安门"}
+	for _, workers := range []int{0, 1, 3} {
+		batch := te.ExtractTagsBatch(sentences, 5, workers)
+		if len(batch) != len(sentences) {
+			t.Fatalf("got %d results, expected %d", len(batch), len(sentences))
+		}
+		for i, sentence := range sentences {
+			expected := te.ExtractTags(sentence, 5)
+			if len(batch[i]) != len(expected) {
+				t.Fatalf("got %v for %s, expected %v", batch[i], sentence, expected)
+			}
+			for j := range expected {
+				if batch[i][j] != expected[j] {
+					t.Fatalf("got %v for %s, expected %v", batch[i], sentence, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestExtractTagsKeepCase(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n", "OpenAI 10\nGPT 8\n")
+	te.GetStopWord().Add("Released")
+	tags := te.ExtractTags("OpenAI released GPT", ExtractAll)
+	expected := []string{"OpenAI", "GPT"}
+	if len(tags) != len(expected) {
+		t.Fatalf("got %v, expected %v", tags, expected)
+	}
+	for i, tag := range tags {
+		if tag.Text() != expected[i] {
+			t.Fatalf("got %v, expected %v", tags, expected)
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	te := newTestTagExtracter("服务器 100 n\n伺服器 100 n\n性能 100 n\n", "服务器 2\n性能 3\nserver 4\n")
+	sentence := "服务器性能，伺服器，Server，server"
+	if tags := te.ExtractTags(sentence, ExtractAll); len(tags) != 5 {
+		t.Fatalf("got %v, expected the variants counted apart without Canonicalize", tags)
+	}
+	te.Canonicalize = func(word string) string {
+		if word == "伺服器" {
+			return "服务器"
+		}
+		return strings.ToLower(word)
+	}
+	tags := te.ExtractTags(sentence, ExtractAll)
+	expected := Segments{{"server", 4 * 2.0 / 5}, {"服务器", 2 * 2.0 / 5}, {"性能", 3 * 1.0 / 5}}
+	if len(tags) != len(expected) {
+		t.Fatalf("got %v, expected %v", tags, expected)
+	}
+	for i := range tags {
+		if tags[i].Text() != expected[i].Text() || math.Abs(tags[i].Weight()-expected[i].Weight()) > 1e-9 {
+			t.Fatalf("got %v, expected %v", tags, expected)
+		}
+	}
+	if phrases := te.ExtractKeyphrases(sentence, 2); len(phrases) != 2 || phrases[1].Text() != "服务器性能" {
+		t.Fatalf("got %v, expected server and 服务器性能", phrases)
+	}
+	positioned := te.ExtractTagsWithPositions(sentence, 2)
+	expectedPositions := [][][2]int{{{10, 16}, {17, 23}}, {{0, 3}, {6, 9}}}
+	for i, tag := range positioned {
+		if tag.Text != expected[i].Text() || len(tag.Positions) != len(expectedPositions[i]) {
+			t.Fatalf("got %v, expected positions %v", positioned, expectedPositions)
+		}
+		for j := range tag.Positions {
+			if tag.Positions[j] != expectedPositions[i][j] {
+				t.Fatalf("got %v, expected positions %v", positioned, expectedPositions)
+			}
+		}
+	}
+	highlighted := "<b>服务器</b>性能，<b>伺服器</b>，<b>Server</b>，<b>server</b>"
+	if result := te.Highlight(sentence, tags[:2], "<b>", "</b>"); result != highlighted {
+		t.Fatalf("got %q, expected %q", result, highlighted)
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"dict.txt": "北京 100 ns\n天安门 100 ns\n我 100 r\n爱 100 v\n",
+		"idf.txt":  "北京 1\n天安门 10\n",
+		"stop.txt": "天安门\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	var te TagExtracter
+	if err := te.LoadAll(path("dict.txt"), path("idf.txt"), path("stop.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if tags := te.ExtractTags("我爱北京天安门", ExtractAll); len(tags) != 1 || tags[0].Text() != "北京" {
+		t.Fatalf("got %v, expected only 北京", tags)
+	}
+	err := te.LoadAll(path("dict.txt"), path("missing.txt"), path("stop.txt"))
+	if err == nil || !strings.Contains(err.Error(), "IDF") || !strings.Contains(err.Error(), "missing.txt") {
+		t.Fatalf("got error %v, expected one telling missing.txt failed", err)
+	}
+	err = te.LoadAll(path("dict.txt"), path("idf.txt"), path("missing.txt"))
+	if err == nil || !strings.Contains(err.Error(), "stop words") {
+		t.Fatalf("got error %v, expected one telling the stop words failed", err)
+	}
+
+	var tr TagExtracter
+	err = tr.LoadAllReaders(strings.NewReader(files["dict.txt"]), strings.NewReader(files["idf.txt"]), strings.NewReader(files["stop.txt"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := tr.ExtractTags("我爱北京天安门", ExtractAll); len(tags) != 1 || tags[0].Text() != "北京" {
+		t.Fatalf("got %v, expected only 北京", tags)
+	}
+}
+
+func TestKeepSingleChars(t *testing.T) {
+	te := newTestTagExtracter("喝 100 v\n茶 100 n\n的 100 u\n好 100 a\n绿茶 100 n\n", "茶 5\n绿茶 3\n的 1\n好 1\n")
+	sentence := "喝的好茶，绿茶"
+	if tags := te.ExtractTags(sentence, ExtractAll); len(tags) != 1 || tags[0].Text() != "绿茶" {
+		t.Fatalf("got %v, expected only 绿茶", tags)
+	}
+	te.KeepSingleChars = map[string]bool{"茶": true}
+	tags := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != 2 || tags[0].Text() != "茶" || tags[1].Text() != "绿茶" {
+		t.Fatalf("got %v, expected 茶 kept and 的 dropped", tags)
+	}
+}
+
+func TestExtractTagsTiesDeterministic(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n上海 100 ns\n广州 100 ns\n深圳 100 ns\n杭州 100 ns\n南京 100 ns\n", "北京 1\n上海 1\n广州 1\n深圳 1\n杭州 1\n南京 1\n")
+	sentence := "北京，上海，广州，深圳，杭州，南京"
+	expected := te.ExtractTags(sentence, ExtractAll)
+	if len(expected) != 6 {
+		t.Fatalf("got %v, expected 6 tags", expected)
+	}
+	for i := 1; i < len(expected); i++ {
+		if expected[i].Weight() != expected[0].Weight() || expected[i-1].Text() < expected[i].Text() {
+			t.Fatalf("got %v, expected tied tags in descending text order", expected)
+		}
+	}
+	for run := 0; run < 50; run++ {
+		tags := te.ExtractTags(sentence, ExtractAll)
+		cnTags, _ := te.CNExtractTags(sentence, ExtractAll)
+		for i := range expected {
+			if tags[i] != expected[i] || cnTags[i] != expected[i] {
+				t.Fatalf("run %d got %v and %v, expected %v", run, tags, cnTags, expected)
+			}
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n故宫 100 ns\n", "北京 1\n天安门 2\n故宫 3\n")
+	expected := te.ExtractTags("北京天安门", ExtractAll)
+	te.ExtractTags("故宫故宫故宫", ExtractAll)
+	te.Reset()
+	tags := te.ExtractTags("北京天安门", ExtractAll)
+	if len(tags) != len(expected) {
+		t.Fatalf("got %v, expected %v", tags, expected)
+	}
+	for i := range tags {
+		if tags[i] != expected[i] {
+			t.Fatalf("got %v, expected %v", tags, expected)
+		}
+	}
+	var zero TagExtracter
+	zero.Reset()
+}
+
+func TestMinTermFreq(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n天安门 100 ns\n故宫 100 ns\n我 100 r\n爱 100 v\n", "北京 1\n天安门 2\n故宫 100\n")
+	sentence := strings.Repeat("我爱北京天安门，", 10) + "我爱故宫"
+	if tags := te.ExtractTags(sentence, 1); len(tags) != 1 || tags[0].Text() != "故宫" {
+		t.Fatalf("got %v, expected the rare 故宫 with the highest IDF", tags)
+	}
+	all := te.ExtractTags(sentence, ExtractAll)
+	te.MinTermFreq = 2
+	tags := te.ExtractTags(sentence, ExtractAll)
+	if len(tags) != 2 || tags[0].Text() != "天安门" || tags[1].Text() != "北京" {
+		t.Fatalf("got %v, expected 故宫 excluded", tags)
+	}
+	if tags[0] != all[1] {
+		t.Fatalf("got %v, expected the weights unchanged as %v", tags, all)
+	}
+	if tags, _ := te.CNExtractTags(sentence, ExtractAll); len(tags) != 2 {
+		t.Fatalf("got %v, expected 故宫 excluded", tags)
+	}
+}
+
+func TestExtractTagsBlank(t *testing.T) {
+	te := newTestTagExtracter("北京 100 ns\n", "北京 1\n")
+	for _, sentence := range []string{"", "   ", "。"} {
+		if tags := te.ExtractTags(sentence, 5); tags == nil || len(tags) != 0 {
+			t.Fatalf("%q: got %v, expected an empty result", sentence, tags)
+		}
+		tags, words := te.CNExtractTags(sentence, 5)
+		if tags == nil || len(tags) != 0 || len(words) != 0 {
+			t.Fatalf("%q: got %v and %q, expected empty results", sentence, tags, words)
+		}
+	}
+
+	// blank input returns before cutting, even without dictionaries loaded
+	var zero TagExtracter
+	for _, sentence := range []string{"", " \n "} {
+		if tags := zero.ExtractTagsWithIdf(sentence, 5, "news"); tags == nil || len(tags) != 0 {
+			t.Fatalf("%q: got %v, expected an empty result", sentence, tags)
+		}
+		if tags := zero.ExtractTagsWithPositions(sentence, 5); tags == nil || len(tags) != 0 {
+			t.Fatalf("%q: got %v, expected an empty result", sentence, tags)
+		}
+		if tags := zero.ExtractTagsDetailed(sentence, 5); tags == nil || len(tags) != 0 {
+			t.Fatalf("%q: got %v, expected an empty result", sentence, tags)
+		}
+		if tags := zero.ExtractKeyphrases(sentence, 5); tags == nil || len(tags) != 0 {
+			t.Fatalf("%q: got %v, expected an empty result", sentence, tags)
+		}
+	}
+}
@@ -1,13 +1,21 @@
 package analyse
 
 import (
+	"fmt"
 	"math"
 	"sort"
+	"strings"
 
+	"github.com/kricen/jiebago"
 	"github.com/kricen/jiebago/posseg"
 )
 
-const dampingFactor = 0.85
+const (
+	dampingFactor = 0.85
+	defaultSpan   = 5
+	maxIterations = 100
+	tolerance     = 1e-6
+)
 
 var (
 	defaultAllowPOS = []string{"ns", "n", "vn", "v"}
@@ -61,7 +69,32 @@ func (u *undirectWeightedGraph) addEdge(start, end string, weight float64) {
 	}
 }
 
+// addEdges adds all co-occurrence pairs in sorted order, so that the ranks
+// are deterministic regardless of map iteration order.
+func (u *undirectWeightedGraph) addEdges(cm map[[2]string]float64) {
+	pairs := make([][2]string, 0, len(cm))
+	for pair := range cm {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] == pairs[j][0] {
+			return pairs[i][1] < pairs[j][1]
+		}
+		return pairs[i][0] < pairs[j][0]
+	})
+	for _, pair := range pairs {
+		u.addEdge(pair[0], pair[1], cm[pair])
+	}
+}
+
 func (u *undirectWeightedGraph) rank() Segments {
+	return u.rankWith(dampingFactor, 10, 0)
+}
+
+// rankWith runs at most maxIter iterations with damping factor d, it stops
+// earlier once no weight changes more than tol. A non-positive tol always
+// runs maxIter iterations.
+func (u *undirectWeightedGraph) rankWith(d float64, maxIter int, tol float64) Segments {
 	if !sort.IsSorted(u.keys) {
 		sort.Sort(u.keys)
 	}
@@ -82,14 +115,20 @@ func (u *undirectWeightedGraph) rank() Segments {
 		outSum[n] = sum
 	}
 
-	for x := 0; x < 10; x++ {
+	for x := 0; x < maxIter; x++ {
+		delta := 0.0
 		for _, n := range u.keys {
 			s := 0.0
 			inedges := u.graph[n]
 			for _, e := range inedges {
 				s += e.weight / outSum[e.end] * ws[e.end]
 			}
-			ws[n] = (1 - dampingFactor) + dampingFactor*s
+			w := (1 - d) + d*s
+			delta = math.Max(delta, math.Abs(w-ws[n]))
+			ws[n] = w
+		}
+		if tol > 0 && delta < tol {
+			break
 		}
 	}
 	minRank := math.MaxFloat64
@@ -97,7 +136,8 @@ func (u *undirectWeightedGraph) rank() Segments {
 	for _, w := range ws {
 		if w < minRank {
 			minRank = w
-		} else if w > maxRank {
+		}
+		if w > maxRank {
 			maxRank = w
 		}
 	}
@@ -137,9 +177,7 @@ func (t *TextRanker) TextRankWithPOS(sentence string, topK int, allowPOS []strin
 			}
 		}
 	}
-	for startEnd, weight := range cm {
-		g.addEdge(startEnd[0], startEnd[1], weight)
-	}
+	g.addEdges(cm)
 	tags := g.rank()
 	if topK > 0 && len(tags) > topK {
 		tags = tags[:topK]
@@ -163,3 +201,162 @@ func (t *TextRanker) LoadDictionary(fileName string) error {
 	t.seg = new(posseg.Segmenter)
 	return t.seg.LoadDictionary(fileName)
 }
+
+// TextRankExtracter extracts keywords from sentence using TextRank algorithm.
+// Unlike TextRanker, it does not depend on POS tagging, it shares the same
+// Segmenter and StopWord dictionary as TagExtracter.
+type TextRankExtracter struct {
+	seg      *jiebago.Segmenter
+	stopWord *StopWord
+
+	// Span is the size of the co-occurrence window, see TextRankOptions,
+	// defaults to 5.
+	Span int
+	// DampingFactor is the damping factor of the PageRank-style iteration,
+	// defaults to 0.85.
+	DampingFactor float64
+
+	// maxIter, tol and unweighted are set by NewTextRankExtracterWithOptions,
+	// see TextRankOptions.
+	maxIter    int
+	tol        float64
+	unweighted bool
+}
+
+// TextRankOptions configures a TextRankExtracter created by
+// NewTextRankExtracterWithOptions. Zero values of the numeric fields mean the
+// defaults of jieba, see DefaultTextRankOptions.
+type TextRankOptions struct {
+	// Span is the size of the co-occurrence window, every candidate word is
+	// paired with the candidate words among the next Span-1 words, the other
+	// words in the window are skipped. A span of 1 pairs no words, so there
+	// are no edges and no key words.
+	Span int
+	// Weighted weights every edge by the number of co-occurrences of its
+	// words, otherwise all the edges weigh 1.
+	Weighted bool
+	// Damping is the damping factor, it must be in [0, 1).
+	Damping float64
+	// MaxIter is the maximum number of iterations.
+	MaxIter int
+	// Tol stops the iterations once no weight changes more than it, a
+	// negative Tol always runs MaxIter iterations.
+	Tol float64
+}
+
+// DefaultTextRankOptions returns the options used by NewTextRankExtracter,
+// which are the same as jieba's: span 5, weighted edges, damping factor 0.85,
+// at most 100 iterations until weights change less than 1e-6.
+func DefaultTextRankOptions() TextRankOptions {
+	return TextRankOptions{
+		Span:     defaultSpan,
+		Weighted: true,
+		Damping:  dampingFactor,
+		MaxIter:  maxIterations,
+		Tol:      tolerance,
+	}
+}
+
+// NewTextRankExtracter creates a new TextRankExtracter with default span and
+// damping factor.
+func NewTextRankExtracter() *TextRankExtracter {
+	return &TextRankExtracter{Span: defaultSpan, DampingFactor: dampingFactor}
+}
+
+// NewTextRankExtracterWithOptions creates a new TextRankExtracter configured
+// by opts, it returns an error if any option is out of range.
+func NewTextRankExtracterWithOptions(opts TextRankOptions) (*TextRankExtracter, error) {
+	switch {
+	case opts.Span < 0:
+		return nil, fmt.Errorf("analyse: TextRank span %d, expected at least 1", opts.Span)
+	case opts.Damping < 0 || opts.Damping >= 1:
+		return nil, fmt.Errorf("analyse: TextRank damping factor %v, expected in [0, 1)", opts.Damping)
+	case opts.MaxIter < 0:
+		return nil, fmt.Errorf("analyse: TextRank max iterations %d, expected non-negative", opts.MaxIter)
+	}
+	return &TextRankExtracter{
+		Span:          opts.Span,
+		DampingFactor: opts.Damping,
+		maxIter:       opts.MaxIter,
+		tol:           opts.Tol,
+		unweighted:    !opts.Weighted,
+	}, nil
+}
+
+// LoadDictionary reads the given filename and create a new dictionary.
+func (t *TextRankExtracter) LoadDictionary(fileName string) error {
+	t.stopWord = NewStopWord()
+	t.seg = new(jiebago.Segmenter)
+	return t.seg.LoadDictionary(fileName)
+}
+
+// LoadStopWords reads the given file and create a new StopWord dictionary.
+func (t *TextRankExtracter) LoadStopWords(fileName string) error {
+	t.stopWord = NewStopWord()
+	return t.stopWord.loadDictionary(fileName)
+}
+
+func (t *TextRankExtracter) span() int {
+	if t.Span > 0 {
+		return t.Span
+	}
+	return defaultSpan
+}
+
+func (t *TextRankExtracter) dampingFactor() float64 {
+	if t.DampingFactor > 0 && t.DampingFactor < 1 {
+		return t.DampingFactor
+	}
+	return dampingFactor
+}
+
+func (t *TextRankExtracter) maxIterations() int {
+	if t.maxIter > 0 {
+		return t.maxIter
+	}
+	return maxIterations
+}
+
+func (t *TextRankExtracter) tolerance() float64 {
+	if t.tol != 0 {
+		return t.tol
+	}
+	return tolerance
+}
+
+func (t *TextRankExtracter) isCandidate(word string) bool {
+	return isCandidate(word, defaultMinWordLen, t.stopWord)
+}
+
+// ExtractTags extracts the topK key words from sentence, see
+// TagExtracter.ExtractTags for the meaning of topK. The weights are
+// normalized to [0, 1], so that they are comparable across sentences.
+func (t *TextRankExtracter) ExtractTags(sentence string, topK int) Segments {
+	if t.seg == nil {
+		panic(errNoDictionary)
+	}
+	var words []string
+	for w := range t.seg.Cut(sentence, true) {
+		words = append(words, strings.TrimSpace(w))
+	}
+	span := t.span()
+	cm := make(map[[2]string]float64)
+	for i := range words {
+		if !t.isCandidate(words[i]) {
+			continue
+		}
+		for j := i + 1; j < i+span && j < len(words); j++ {
+			if !t.isCandidate(words[j]) {
+				continue
+			}
+			if t.unweighted {
+				cm[[2]string{words[i], words[j]}] = 1.0
+			} else {
+				cm[[2]string{words[i], words[j]}] += 1.0
+			}
+		}
+	}
+	g := newUndirectWeightedGraph()
+	g.addEdges(cm)
+	return g.rankWith(t.dampingFactor(), t.maxIterations(), t.tolerance()).top(topK)
+}
@@ -2,7 +2,10 @@ package analyse
 
 import (
 	"math"
+	"strings"
 	"testing"
+
+	"github.com/kricen/jiebago"
 )
 
 var (
@@ -32,3 +35,107 @@ func TestTextRank(t *testing.T) {
 		}
 	}
 }
+
+func TestTextRankExtracter(t *testing.T) {
+	te := NewTextRankExtracter()
+	te.LoadDictionary("../dict.txt")
+	results := te.ExtractTags(sentence, 10)
+	if len(results) == 0 || len(results) > 10 {
+		t.Fatalf("got %d tags, expected 1 to 10", len(results))
+	}
+	if math.Abs(results[0].weight-1.0) > 1e-6 {
+		t.Fatalf("top tag %v should be normalized to 1.0", results[0])
+	}
+	for index, tw := range results {
+		if tw.weight <= 0 || tw.weight > 1.0+1e-6 {
+			t.Fatalf("%v is not normalized to [0, 1]", tw)
+		}
+		if index > 0 && tw.weight > results[index-1].weight {
+			t.Fatalf("%v should not rank after %v", tw, results[index-1])
+		}
+		if te.stopWord.IsStopWord(tw.text) || len([]rune(tw.text)) < 2 {
+			t.Fatalf("%v should not be a candidate", tw)
+		}
+	}
+
+	var zero TextRankExtracter
+	zero.LoadDictionary("../dict.txt")
+	for index, tw := range zero.ExtractTags(sentence, 10) {
+		if math.Abs(tw.weight-results[index].weight) > 1e-6 {
+			t.Fatalf("zero value TextRankExtracter got %v, expected %v", tw, results[index])
+		}
+	}
+}
+
+func TestTextRankDeterministic(t *testing.T) {
+	var tr TextRanker
+	tr.LoadDictionary("../dict.txt")
+	te := NewTextRankExtracter()
+	te.LoadDictionary("../dict.txt")
+	expected := tr.TextRank(sentence, -1)
+	expectedExtracter := te.ExtractTags(sentence, -1)
+	for i := 0; i < 20; i++ {
+		for index, tw := range tr.TextRank(sentence, -1) {
+			if tw != expected[index] {
+				t.Fatalf("run %d got %v, expected %v", i, tw, expected[index])
+			}
+		}
+		for index, tw := range te.ExtractTags(sentence, -1) {
+			if tw != expectedExtracter[index] {
+				t.Fatalf("run %d got %v, expected %v", i, tw, expectedExtracter[index])
+			}
+		}
+	}
+}
+
+func TestTextRankOptions(t *testing.T) {
+	for _, opts := range []TextRankOptions{{Span: -1}, {Damping: 1}, {MaxIter: -1}} {
+		if _, err := NewTextRankExtracterWithOptions(opts); err == nil {
+			t.Fatalf("got no error for %+v", opts)
+		}
+	}
+	newExtracter := func(opts TextRankOptions) *TextRankExtracter {
+		te, err := NewTextRankExtracterWithOptions(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		te.stopWord = NewStopWord()
+		te.seg = new(jiebago.Segmenter)
+		te.seg.LoadDictionaryReader(strings.NewReader("北京 100\n天安门 100\n故宫 100\n长城 100\n"))
+		return te
+	}
+	sentence := "北京天安门，北京天安门，北京天安门，北京故宫长城"
+	expected := NewTextRankExtracter()
+	expected.stopWord = NewStopWord()
+	expected.seg = newExtracter(DefaultTextRankOptions()).seg
+	weighted := newExtracter(DefaultTextRankOptions()).ExtractTags(sentence, ExtractAll)
+	for i, tw := range expected.ExtractTags(sentence, ExtractAll) {
+		if tw != weighted[i] {
+			t.Fatalf("got %v with the default options, expected %v", weighted, tw)
+		}
+	}
+	unweighted := newExtracter(TextRankOptions{}).ExtractTags(sentence, ExtractAll)
+	if len(unweighted) != len(weighted) {
+		t.Fatalf("got %v, expected the same words as %v", unweighted, weighted)
+	}
+	for i := range unweighted {
+		if unweighted[i] == weighted[i] {
+			continue
+		}
+		return
+	}
+	t.Fatalf("got %v, expected weights different from %v", unweighted, weighted)
+}
+
+func TestTextRankSpanOne(t *testing.T) {
+	te, err := NewTextRankExtracterWithOptions(TextRankOptions{Span: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.stopWord = NewStopWord()
+	te.seg = new(jiebago.Segmenter)
+	te.seg.LoadDictionaryReader(strings.NewReader("北京 100\n天安门 100\n"))
+	if tags := te.ExtractTags("北京天安门，北京天安门", ExtractAll); len(tags) != 0 {
+		t.Fatalf("got %v, expected no tags without edges", tags)
+	}
+}
@@ -0,0 +1,20 @@
+package jiebago
+
+import (
+	"bytes"
+	_ "embed" // for the bundled dictionary
+)
+
+//go:embed dict.txt
+var defaultDictionary []byte
+
+// NewWithDefault creates a Segmenter with the bundled dictionary loaded, so
+// no dictionary file needs to be located. Call LoadDictionary on it to use a
+// custom dictionary instead.
+func NewWithDefault() (*Segmenter, error) {
+	seg := new(Segmenter)
+	if err := seg.LoadDictionaryReader(bytes.NewReader(defaultDictionary)); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
@@ -1,7 +1,10 @@
 package jiebago
 
 import (
+	"io"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/kricen/jiebago/dictionary"
@@ -10,30 +13,55 @@ import (
 // A Dictionary represents a thread-safe dictionary used for word segmentation.
 type Dictionary struct {
 	total, logTotal float64
-	freqMap         map[string]float64
+	// count is the number of words with positive frequency.
+	count int
+	// median is the median frequency of the words, computed on demand, it is
+	// valid only if medianOK is true.
+	median   float64
+	medianOK bool
+	// deletes is the index used by fuzzy matching, built on demand, see
+	// fuzzyIndex.
+	deletes map[string][]string
+	// sorted is the words with positive frequency in ascending order, built
+	// on demand, see sortedWords.
+	sorted  []string
+	freqMap map[string]float64
+	posMap  map[string]string
 	sync.RWMutex
 }
 
+func newDictionary() *Dictionary {
+	return &Dictionary{freqMap: make(map[string]float64), posMap: make(map[string]string)}
+}
+
 // Load loads all tokens from given channel
 func (d *Dictionary) Load(ch <-chan dictionary.Token) {
 	d.Lock()
 	for token := range ch {
 		d.addToken(token)
 	}
-	d.Unlock()
 	d.updateLogTotal()
+	d.Unlock()
 }
 
 // AddToken adds one token
 func (d *Dictionary) AddToken(token dictionary.Token) {
 	d.Lock()
 	d.addToken(token)
-	d.Unlock()
 	d.updateLogTotal()
+	d.Unlock()
 }
 
 func (d *Dictionary) addToken(token dictionary.Token) {
+	if old := d.freqMap[token.Text()]; old > 0 && token.Frequency() <= 0 {
+		d.count--
+	} else if old <= 0 && token.Frequency() > 0 {
+		d.count++
+	}
 	d.freqMap[token.Text()] = token.Frequency()
+	d.medianOK = false
+	d.deletes = nil
+	d.sorted = nil
 	d.total += token.Frequency()
 	runes := []rune(token.Text())
 	n := len(runes)
@@ -43,12 +71,91 @@ func (d *Dictionary) addToken(token dictionary.Token) {
 			d.freqMap[frag] = 0.0
 		}
 	}
+	if len(token.Pos()) > 0 {
+		d.posMap[token.Text()] = token.Pos()
+	}
 }
 
 func (d *Dictionary) updateLogTotal() {
 	d.logTotal = math.Log(d.total)
 }
 
+func (d *Dictionary) totals() (total, logTotal float64) {
+	d.RLock()
+	total, logTotal = d.total, d.logTotal
+	d.RUnlock()
+	return
+}
+
+// Stats returns the total frequency of all the words, which is used as the
+// denominator of word probabilities, and the number of words with positive
+// frequency.
+func (d *Dictionary) Stats() (totalFreq float64, wordCount int) {
+	d.RLock()
+	totalFreq, wordCount = d.total, d.count
+	d.RUnlock()
+	return
+}
+
+// Median returns the median frequency of all the words with positive
+// frequency, or 0 if there is no such word.
+func (d *Dictionary) Median() float64 {
+	d.RLock()
+	median, ok := d.median, d.medianOK
+	d.RUnlock()
+	if ok {
+		return median
+	}
+	d.Lock()
+	defer d.Unlock()
+	if !d.medianOK {
+		freqs := make([]float64, 0, d.count)
+		for _, freq := range d.freqMap {
+			if freq > 0 {
+				freqs = append(freqs, freq)
+			}
+		}
+		sort.Float64s(freqs)
+		d.median = 0
+		if len(freqs) > 0 {
+			d.median = freqs[len(freqs)/2]
+		}
+		d.medianOK = true
+	}
+	return d.median
+}
+
+// fuzzyIndex returns the index from every string made by deleting one rune of
+// a word of 2 to maxFuzzyLen+1 runes to those words. The index is never
+// modified once built, it is rebuilt after new tokens are added.
+func (d *Dictionary) fuzzyIndex() map[string][]string {
+	d.RLock()
+	deletes := d.deletes
+	d.RUnlock()
+	if deletes != nil {
+		return deletes
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.deletes == nil {
+		d.deletes = make(map[string][]string)
+		for word, freq := range d.freqMap {
+			if freq <= 0 {
+				continue
+			}
+			runes := []rune(word)
+			if len(runes) < 2 || len(runes) > maxFuzzyLen+1 {
+				continue
+			}
+			for i := range runes {
+				key := deleteRune(runes, i)
+				d.deletes[key] = append(d.deletes[key], word)
+			}
+		}
+	}
+	return d.deletes
+}
+
 // Frequency returns the frequency and existence of give word
 func (d *Dictionary) Frequency(key string) (float64, bool) {
 	d.RLock()
@@ -57,6 +164,126 @@ func (d *Dictionary) Frequency(key string) (float64, bool) {
 	return freq, ok
 }
 
+// Pos returns the POS and existence of give word
+func (d *Dictionary) Pos(key string) (string, bool) {
+	d.RLock()
+	pos, ok := d.posMap[key]
+	d.RUnlock()
+	return pos, ok
+}
+
+// tokens returns all words with positive frequency, sorted by text.
+func (d *Dictionary) tokens() []dictionary.Token {
+	d.RLock()
+	words := make([]string, 0, len(d.freqMap))
+	for word, freq := range d.freqMap {
+		if freq > 0 {
+			words = append(words, word)
+		}
+	}
+	sort.Strings(words)
+	tokens := make([]dictionary.Token, len(words))
+	for i, word := range words {
+		tokens[i] = dictionary.NewToken(word, d.freqMap[word], d.posMap[word])
+	}
+	d.RUnlock()
+	return tokens
+}
+
+// sortedWords returns the words with positive frequency in ascending order.
+// The slice is never modified once built, it is rebuilt after new tokens are
+// added.
+func (d *Dictionary) sortedWords() []string {
+	d.RLock()
+	sorted := d.sorted
+	d.RUnlock()
+	if sorted != nil {
+		return sorted
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.sorted == nil {
+		d.sorted = make([]string, 0, d.count)
+		for word, freq := range d.freqMap {
+			if freq > 0 {
+				d.sorted = append(d.sorted, word)
+			}
+		}
+		sort.Strings(d.sorted)
+	}
+	return d.sorted
+}
+
+// withPrefix returns all words with positive frequency starting with prefix,
+// sorted by descending frequency and then by text. The words starting with
+// prefix are adjacent in sortedWords, so they are found by binary search
+// without scanning the whole dictionary.
+func (d *Dictionary) withPrefix(prefix string) []dictionary.Token {
+	words := d.sortedWords()
+	d.RLock()
+	defer d.RUnlock()
+	var tokens []dictionary.Token
+	for i := sort.SearchStrings(words, prefix); i < len(words) && strings.HasPrefix(words[i], prefix); i++ {
+		// words may be outdated if tokens are added meanwhile
+		if freq := d.freqMap[words[i]]; freq > 0 {
+			tokens = append(tokens, dictionary.NewToken(words[i], freq, d.posMap[words[i]]))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Frequency() == tokens[j].Frequency() {
+			return tokens[i].Text() < tokens[j].Text()
+		}
+		return tokens[i].Frequency() > tokens[j].Frequency()
+	})
+	return tokens
+}
+
 func (d *Dictionary) loadDictionary(fileName string) error {
 	return dictionary.LoadDictionary(d, fileName)
 }
+
+func (d *Dictionary) loadDictionaryReader(r io.Reader) error {
+	return dictionary.LoadDictionaryReader(d, r)
+}
+
+// tokenList is a DictLoader keeping all the tokens in order.
+type tokenList []dictionary.Token
+
+func (l *tokenList) Load(ch <-chan dictionary.Token) {
+	for token := range ch {
+		*l = append(*l, token)
+	}
+}
+
+func (l *tokenList) AddToken(token dictionary.Token) {
+	*l = append(*l, token)
+}
+
+// addScaled adds tokens with their frequencies multiplied by scale, if scale
+// is not positive, it is computed so that the mean frequency of tokens
+// equals the mean frequency of current words.
+func (d *Dictionary) addScaled(tokens []dictionary.Token, scale float64) {
+	d.Lock()
+	if scale <= 0 {
+		scale = 1.0
+		total, count := 0.0, 0
+		for _, token := range tokens {
+			if token.Frequency() > 0 {
+				total += token.Frequency()
+				count++
+			}
+		}
+		if total > 0 && d.count > 0 {
+			scale = (d.total / float64(d.count)) / (total / float64(count))
+		}
+	}
+	for _, token := range tokens {
+		d.addToken(dictionary.NewToken(token.Text(), token.Frequency()*scale, token.Pos()))
+	}
+	d.updateLogTotal()
+	d.Unlock()
+}
+
+func (d *Dictionary) loadDictionaryStrict(fileName string) error {
+	return dictionary.LoadDictionaryStrict(d, fileName)
+}
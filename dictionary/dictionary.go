@@ -4,6 +4,9 @@ package dictionary
 
 import (
 	"bufio"
+	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -17,35 +20,91 @@ type DictLoader interface {
 	AddToken(Token)
 }
 
-func loadDictionary(file *os.File) (<-chan Token, <-chan error) {
-	tokenCh, errCh := make(chan Token), make(chan error)
+// parseLine parses one dictionary line in the format
+// "word [frequency [pos]]", fields are separated by a single space.
+func parseLine(line string) (Token, error) {
+	var token Token
+	var err error
+	fields := strings.Split(line, " ")
+	token.text = strings.TrimSpace(strings.Replace(fields[0], "\ufeff", "", 1))
+	if length := len(fields); length > 1 {
+		token.frequency, err = strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return token, fmt.Errorf("invalid frequency %q for word %q", fields[1], token.text)
+		}
+		if length > 2 {
+			token.pos = strings.TrimSpace(fields[2])
+		}
+	}
+	return token, nil
+}
+
+// parseLineStrict parses one dictionary line like parseLine, but also rejects
+// lines with more than three fields, empty fields and negative or non-finite
+// frequencies.
+func parseLineStrict(line string) (Token, error) {
+	fields := strings.Split(line, " ")
+	if len(fields) > 3 {
+		return Token{}, fmt.Errorf("got %d fields, expected at most 3", len(fields))
+	}
+	for _, field := range fields {
+		if len(strings.TrimSpace(field)) == 0 {
+			return Token{}, fmt.Errorf("empty field")
+		}
+	}
+	token, err := parseLine(line)
+	if err != nil {
+		return token, err
+	}
+	if f := token.frequency; f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return token, fmt.Errorf("invalid frequency %q for word %q", fields[1], token.text)
+	}
+	return token, nil
+}
+
+// cleanLine strips the UTF-8 byte order mark at the start of the first line
+// and a carriage return left at the end of a CRLF line.
+func cleanLine(line string, lineNo int) string {
+	if lineNo == 1 {
+		line = strings.TrimPrefix(line, "\ufeff")
+	}
+	return strings.TrimSuffix(line, "\r")
+}
+
+func loadDictionary(r io.Reader) (<-chan Token, <-chan error) {
+	return loadDictionaryWith(r, parseLine, false)
+}
+
+// loadDictionaryWith parses every non-empty line with parse, if verbose is
+// true the content of the malformed line is included in the error.
+func loadDictionaryWith(r io.Reader, parse func(string) (Token, error), verbose bool) (<-chan Token, <-chan error) {
+	tokenCh, errCh := make(chan Token), make(chan error, 1)
 
 	go func() {
 		defer close(tokenCh)
 		defer close(errCh)
-		scanner := bufio.NewScanner(file)
-		var token Token
+		scanner := bufio.NewScanner(r)
 		var line string
-		var fields []string
-		var err error
+		lineNo := 0
 		for scanner.Scan() {
-			line = scanner.Text()
-			fields = strings.Split(line, " ")
-			token.text = strings.TrimSpace(strings.Replace(fields[0], "\ufeff", "", 1))
-			if length := len(fields); length > 1 {
-				token.frequency, err = strconv.ParseFloat(fields[1], 64)
-				if err != nil {
-					errCh <- err
-					return
-				}
-				if length > 2 {
-					token.pos = strings.TrimSpace(fields[2])
+			lineNo++
+			line = cleanLine(scanner.Text(), lineNo)
+			if len(strings.TrimSpace(line)) == 0 {
+				continue
+			}
+			token, err := parse(line)
+			if err != nil {
+				if verbose {
+					errCh <- fmt.Errorf("dictionary: line %d %q: %v", lineNo, line, err)
+				} else {
+					errCh <- fmt.Errorf("dictionary: line %d: %v", lineNo, err)
 				}
+				return
 			}
 			tokenCh <- token
 		}
 
-		if err = scanner.Err(); err != nil {
+		if err := scanner.Err(); err != nil {
 			errCh <- err
 		}
 	}()
@@ -53,19 +112,24 @@ func loadDictionary(file *os.File) (<-chan Token, <-chan error) {
 
 }
 
-func loadStopwords(file *os.File) (<-chan Token, <-chan error) {
-	tokenCh, errCh := make(chan Token), make(chan error)
+func loadStopwords(r io.Reader) (<-chan Token, <-chan error) {
+	tokenCh, errCh := make(chan Token), make(chan error, 1)
 
 	go func() {
 		defer close(tokenCh)
 		defer close(errCh)
-		scanner := bufio.NewScanner(file)
+		scanner := bufio.NewScanner(r)
 		var token Token
 		var line string
 		var err error
+		lineNo := 0
 		for scanner.Scan() {
-			line = scanner.Text()
+			lineNo++
+			line = cleanLine(scanner.Text(), lineNo)
 			token.text = strings.TrimSpace(strings.Replace(line, "\ufeff", "", 1))
+			if len(token.text) == 0 {
+				continue
+			}
 			tokenCh <- token
 		}
 
@@ -88,11 +152,43 @@ func LoadDictionary(dl DictLoader, fileName string) error {
 		return err
 	}
 	defer dictFile.Close()
-	tokenCh, errCh := loadDictionary(dictFile)
+	return LoadDictionaryReader(dl, dictFile)
+}
+
+// LoadDictionaryReader reads from the given reader and passes all tokens to a
+// DictLoader. It returns an error if a line is malformed, tokens before that
+// line have been passed to the DictLoader already.
+func LoadDictionaryReader(dl DictLoader, r io.Reader) error {
+	tokenCh, errCh := loadDictionary(r)
 	dl.Load(tokenCh)
 
 	return <-errCh
+}
 
+// LoadDictionaryStrict reads the given file like LoadDictionary, but returns
+// an error telling the line number and content of the first line with more
+// than three fields, an empty field, e.g. caused by double spaces, or an
+// invalid frequency. It is useful to validate a custom dictionary.
+func LoadDictionaryStrict(dl DictLoader, fileName string) error {
+	filePath, err := dictPath(fileName)
+	if err != nil {
+		return err
+	}
+	dictFile, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer dictFile.Close()
+	return LoadDictionaryStrictReader(dl, dictFile)
+}
+
+// LoadDictionaryStrictReader reads from the given reader like
+// LoadDictionaryReader, but validates every line like LoadDictionaryStrict.
+func LoadDictionaryStrictReader(dl DictLoader, r io.Reader) error {
+	tokenCh, errCh := loadDictionaryWith(r, parseLineStrict, true)
+	dl.Load(tokenCh)
+
+	return <-errCh
 }
 
 // LoadStopwords reads the given file and passes all tokens to a DictLoader.
@@ -106,12 +202,35 @@ func LoadStopwords(dl DictLoader, fileName string) error {
 		return err
 	}
 	defer dictFile.Close()
-	tokenCh, errCh := loadStopwords(dictFile)
+	return LoadStopwordsReader(dl, dictFile)
+}
+
+// LoadStopwordsReader reads from the given reader and passes all tokens to a
+// DictLoader.
+func LoadStopwordsReader(dl DictLoader, r io.Reader) error {
+	tokenCh, errCh := loadStopwords(r)
 	dl.Load(tokenCh)
 
 	return <-errCh
 }
 
+// WriteDictionary writes tokens to the given writer in the format read by
+// LoadDictionaryReader, one "word frequency [pos]" per line.
+func WriteDictionary(w io.Writer, tokens []Token) error {
+	bw := bufio.NewWriter(w)
+	for _, token := range tokens {
+		bw.WriteString(token.text)
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.FormatFloat(token.frequency, 'f', -1, 64))
+		if len(token.pos) > 0 {
+			bw.WriteByte(' ')
+			bw.WriteString(token.pos)
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
 func dictPath(dictFileName string) (string, error) {
 	if filepath.IsAbs(dictFileName) {
 		return dictFileName, nil
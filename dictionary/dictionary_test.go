@@ -1,6 +1,7 @@
 package dictionary
 
 import (
+	"strings"
 	"sync"
 	"testing"
 )
@@ -41,8 +42,8 @@ func TestLoadDictionary(t *testing.T) {
 		t.Fatalf("Failed to load userdict.txt, got %d tokens with frequency, expected 7",
 			len(d.freqMap))
 	}
-	if len(d.posMap) != 6 {
-		t.Fatalf("Failed to load userdict.txt, got %d tokens with pos, expected 6", len(d.posMap))
+	if len(d.posMap) != 5 {
+		t.Fatalf("Failed to load userdict.txt, got %d tokens with pos, expected 5", len(d.posMap))
 	}
 }
 
@@ -57,3 +58,105 @@ func TestAddToken(t *testing.T) {
 		t.Fatalf("Failed to add token, got pos %s, expected \"a\"", d.posMap["好用"])
 	}
 }
+
+func TestLoadDictionaryReader(t *testing.T) {
+	d := &Dict{freqMap: make(map[string]float64), posMap: make(map[string]string)}
+	err := LoadDictionaryReader(d, strings.NewReader("云计算 5\n\n李小福 2 nr\n好用\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.freqMap) != 3 {
+		t.Fatalf("got %d tokens with frequency, expected 3", len(d.freqMap))
+	}
+	if d.freqMap["好用"] != 0 {
+		t.Fatalf("got frequency %f for 好用, expected 0", d.freqMap["好用"])
+	}
+	if len(d.posMap) != 1 || d.posMap["李小福"] != "nr" {
+		t.Fatalf("got pos %v, expected only 李小福 with nr", d.posMap)
+	}
+}
+
+func TestLoadDictionaryNoStalePos(t *testing.T) {
+	d := &Dict{freqMap: make(map[string]float64), posMap: make(map[string]string)}
+	err := LoadDictionaryReader(d, strings.NewReader("李小福 2 nr\n云计算 5\n创新办 3 i\n好用\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for word, pos := range map[string]string{"李小福": "nr", "创新办": "i"} {
+		if d.posMap[word] != pos {
+			t.Fatalf("got pos %q for %s, expected %q", d.posMap[word], word, pos)
+		}
+	}
+	for _, word := range []string{"云计算", "好用"} {
+		if pos, ok := d.posMap[word]; ok {
+			t.Fatalf("got pos %q for %s, expected none instead of the previous line's", pos, word)
+		}
+	}
+}
+
+func TestLoadDictionaryReaderMalformed(t *testing.T) {
+	d := &Dict{freqMap: make(map[string]float64), posMap: make(map[string]string)}
+	err := LoadDictionaryReader(d, strings.NewReader("云计算 5\n李小福 two nr\n好用 300\n"))
+	if err == nil {
+		t.Fatal("expected an error for malformed line")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("error %q should contain the line number", err)
+	}
+}
+
+func TestWriteDictionary(t *testing.T) {
+	var b strings.Builder
+	tokens := []Token{NewToken("云计算", 5, ""), NewToken("李小福", 2.5, "nr")}
+	if err := WriteDictionary(&b, tokens); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "云计算 5\n李小福 2.5 nr\n"; b.String() != expected {
+		t.Fatalf("got %q, expected %q", b.String(), expected)
+	}
+}
+
+func TestLoadDictionaryStrictReader(t *testing.T) {
+	for _, c := range []struct {
+		content, line string
+	}{
+		{"云计算 5\n李小福 2 nr\n好用\n", ""},
+		{"云计算 5\n李小福 two nr\n", `line 2 "李小福 two nr"`},
+		{"云计算 5\n\n李小福 2 nr x\n", `line 3 "李小福 2 nr x"`},
+		{"云计算  5\n", `line 1 "云计算  5"`},
+		{"云计算 -5\n", `line 1 "云计算 -5"`},
+	} {
+		d := &Dict{freqMap: make(map[string]float64), posMap: make(map[string]string)}
+		err := LoadDictionaryStrictReader(d, strings.NewReader(c.content))
+		if c.line == "" {
+			if err != nil {
+				t.Fatalf("%q: got error %v, expected none", c.content, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.line) {
+			t.Fatalf("%q: got error %v, expected one containing %s", c.content, err, c.line)
+		}
+	}
+}
+
+func TestLoadDictionaryReaderBOM(t *testing.T) {
+	d := &Dict{freqMap: make(map[string]float64), posMap: make(map[string]string)}
+	err := LoadDictionaryStrictReader(d, strings.NewReader("\ufeff\r\n云计算 5\r\n李小福 2 nr\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.freqMap) != 2 || d.freqMap["云计算"] != 5 || d.posMap["李小福"] != "nr" {
+		t.Fatalf("got %v and %v, expected 云计算 and 李小福 only", d.freqMap, d.posMap)
+	}
+}
+
+func TestLoadStopwordsReaderBOM(t *testing.T) {
+	d := &Dict{freqMap: make(map[string]float64), posMap: make(map[string]string)}
+	if err := LoadStopwordsReader(d, strings.NewReader("\ufeff的\r\n\r\n了\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.freqMap["的"]; !ok || len(d.freqMap) != 2 {
+		t.Fatalf("got %v, expected 的 and 了 only", d.freqMap)
+	}
+}
@@ -2,6 +2,7 @@ package jiebago_test
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/kricen/jiebago"
 )
@@ -52,7 +53,7 @@ func Example_suggestFrequency() {
 	oldFrequency, _ := seg.Frequency(word)
 	frequency := seg.SuggestFrequency(word)
 	fmt.Printf("%s current frequency: %f, suggest: %f.\n", word, oldFrequency, frequency)
-	seg.AddWord(word, frequency)
+	seg.AddWord(word, frequency, "")
 	fmt.Print("After:")
 	print(seg.Cut(sentence, false))
 
@@ -63,7 +64,7 @@ func Example_suggestFrequency() {
 	oldFrequency, _ = seg.Frequency(word)
 	frequency = seg.SuggestFrequency("中", "将")
 	fmt.Printf("%s current frequency: %f, suggest: %f.\n", word, oldFrequency, frequency)
-	seg.AddWord(word, frequency)
+	seg.AddWord(word, frequency, "")
 	fmt.Print("After:")
 	print(seg.Cut(sentence, false))
 
@@ -72,9 +73,10 @@ func Example_suggestFrequency() {
 	print(seg.Cut(sentence, false))
 	word = "今天天气"
 	oldFrequency, _ = seg.Frequency(word)
-	frequency = seg.SuggestFrequency("今天", "天气")
+	// the suggested frequency is 0, which AddWord would replace with one
+	// keeping the word together, so SuggestFreq applies it instead
+	frequency = seg.SuggestFreq("今天", "天气")
 	fmt.Printf("%s current frequency: %f, suggest: %f.\n", word, oldFrequency, frequency)
-	seg.AddWord(word, frequency)
 	fmt.Print("After:")
 	print(seg.Cut(sentence, false))
 	// Output:
@@ -89,6 +91,21 @@ func Example_suggestFrequency() {
 	// After: 今天 / 天气 / 不错 /
 }
 
+func ExampleSegmenter_SuggestFreq() {
+	var seg jiebago.Segmenter
+	seg.LoadDictionaryReader(strings.NewReader("如果 100\n放到 100\n中将 1000\n中 60\n将 60\n出错 100\n"))
+
+	sentence := "如果放到post中将出错"
+	fmt.Println(seg.CutJoin(sentence, false, "/"))
+	frequency := seg.SuggestFreq("中", "将")
+	fmt.Printf("中将 is set to frequency %f\n", frequency)
+	fmt.Println(seg.CutJoin(sentence, false, "/"))
+	// Output:
+	// 如果/放到/post/中将/出错
+	// 中将 is set to frequency 2.000000
+	// 如果/放到/post/中/将/出错
+}
+
 func Example_loadUserDictionary() {
 	var seg jiebago.Segmenter
 	seg.LoadDictionary("dict.txt")
@@ -10,88 +10,114 @@ var (
 	reSkip = regexp.MustCompile(`(\d+\.\d+|[a-zA-Z0-9]+)`)
 )
 
-func cutHan(sentence string) chan string {
-	result := make(chan string)
-	go func() {
-		runes := []rune(sentence)
-		_, posList := viterbi(runes, []byte{'B', 'M', 'E', 'S'})
-		begin, next := 0, 0
-		for i, char := range runes {
-			pos := posList[i]
-			switch pos {
-			case 'B':
-				begin = i
-			case 'E':
-				result <- string(runes[begin : i+1])
-				next = i + 1
-			case 'S':
-				result <- string(char)
-				next = i + 1
+func (m *Model) cutHan(sentence string, fn func(word string) bool) bool {
+	runes := []rune(sentence)
+	_, posList := m.viterbi(runes, []byte{'B', 'M', 'E', 'S'})
+	begin, next := 0, 0
+	for i, char := range runes {
+		pos := posList[i]
+		switch pos {
+		case 'B':
+			begin = i
+		case 'E':
+			if !fn(string(runes[begin : i+1])) {
+				return false
 			}
+			next = i + 1
+		case 'S':
+			if !fn(string(char)) {
+				return false
+			}
+			next = i + 1
 		}
-		if next < len(runes) {
-			result <- string(runes[next:])
-		}
+	}
+	if next < len(runes) {
+		return fn(string(runes[next:]))
+	}
+	return true
+}
+
+// Cut cuts sentence into words using the built-in Hidden Markov Model with
+// Viterbi algorithm. It is used by Jiebago for unknonw words.
+func Cut(sentence string) chan string {
+	return defaultModel.Cut(sentence)
+}
+
+// CutFunc cuts sentence into words like Cut, but calls fn for every word
+// synchronously instead of sending it to a channel, it stops once fn returns
+// false.
+func CutFunc(sentence string, fn func(word string) bool) {
+	defaultModel.CutFunc(sentence, fn)
+}
+
+// Cut cuts sentence into words like the package level Cut, but uses the
+// probabilities of this model.
+func (m *Model) Cut(sentence string) chan string {
+	result := make(chan string)
+	go func() {
+		m.CutFunc(sentence, func(word string) bool {
+			result <- word
+			return true
+		})
 		close(result)
 	}()
 	return result
 }
 
-// Cut cuts sentence into words using Hidden Markov Model with Viterbi
-// algorithm. It is used by Jiebago for unknonw words.
-func Cut(sentence string) chan string {
-	result := make(chan string)
+// CutFunc cuts sentence into words like the package level CutFunc, but uses
+// the probabilities of this model.
+func (m *Model) CutFunc(sentence string, fn func(word string) bool) {
 	s := sentence
 	var hans string
 	var hanLoc []int
 	var nonhanLoc []int
-	go func() {
-		for {
-			hanLoc = reHan.FindStringIndex(s)
-			if hanLoc == nil {
-				if len(s) == 0 {
-					break
-				}
-			} else if hanLoc[0] == 0 {
-				hans = s[hanLoc[0]:hanLoc[1]]
-				s = s[hanLoc[1]:]
-				for han := range cutHan(hans) {
-					result <- han
-				}
-				continue
+	for {
+		hanLoc = reHan.FindStringIndex(s)
+		if hanLoc == nil {
+			if len(s) == 0 {
+				return
 			}
-			nonhanLoc = reSkip.FindStringIndex(s)
-			if nonhanLoc == nil {
-				if len(s) == 0 {
-					break
-				}
-			} else if nonhanLoc[0] == 0 {
-				nonhans := s[nonhanLoc[0]:nonhanLoc[1]]
-				s = s[nonhanLoc[1]:]
-				if nonhans != "" {
-					result <- nonhans
-					continue
-				}
+		} else if hanLoc[0] == 0 {
+			hans = s[hanLoc[0]:hanLoc[1]]
+			s = s[hanLoc[1]:]
+			if !m.cutHan(hans, fn) {
+				return
+			}
+			continue
+		}
+		nonhanLoc = reSkip.FindStringIndex(s)
+		if nonhanLoc == nil {
+			if len(s) == 0 {
+				return
 			}
-			var loc []int
-			if hanLoc == nil && nonhanLoc == nil {
-				if len(s) > 0 {
-					result <- s
-					break
+		} else if nonhanLoc[0] == 0 {
+			nonhans := s[nonhanLoc[0]:nonhanLoc[1]]
+			s = s[nonhanLoc[1]:]
+			if nonhans != "" {
+				if !fn(nonhans) {
+					return
 				}
-			} else if hanLoc == nil {
-				loc = nonhanLoc
-			} else if nonhanLoc == nil {
-				loc = hanLoc
-			} else if hanLoc[0] < nonhanLoc[0] {
-				loc = hanLoc
-			} else {
-				loc = nonhanLoc
+				continue
 			}
-			result <- s[:loc[0]]
-			s = s[loc[0]:]
 		}
-		close(result)
-	}()
-	return result
+		var loc []int
+		if hanLoc == nil && nonhanLoc == nil {
+			if len(s) > 0 {
+				fn(s)
+				return
+			}
+		} else if hanLoc == nil {
+			loc = nonhanLoc
+		} else if nonhanLoc == nil {
+			loc = hanLoc
+		} else if hanLoc[0] < nonhanLoc[0] {
+			loc = hanLoc
+		} else {
+			loc = nonhanLoc
+		}
+		if !fn(s[:loc[0]]) {
+			return
+		}
+		s = s[loc[0]:]
+	}
 }
@@ -2,6 +2,7 @@ package finalseg
 
 import (
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -16,7 +17,7 @@ func chanToArray(ch chan string) []string {
 func TestViterbi(t *testing.T) {
 	obs := "我们是程序员"
 	states := []byte{'B', 'M', 'E', 'S'}
-	prob, path := viterbi([]rune(obs), states)
+	prob, path := defaultModel.viterbi([]rune(obs), states)
 	if math.Abs(prob+39.68824128493802) > 1e-10 {
 		t.Fatal(prob)
 	}
@@ -29,7 +30,11 @@ func TestViterbi(t *testing.T) {
 
 func TestCutHan(t *testing.T) {
 	obs := "我们是程序员"
-	result := chanToArray(cutHan(obs))
+	var result []string
+	defaultModel.cutHan(obs, func(word string) bool {
+		result = append(result, word)
+		return true
+	})
 	if len(result) != 3 {
 		t.Fatal(result)
 	}
@@ -69,3 +74,34 @@ func TestCut(t *testing.T) {
 	}
 
 }
+
+func TestLoadModel(t *testing.T) {
+	m, err := LoadModel(
+		strings.NewReader("P={'B': -0.5, 'S': -1.0}"),
+		strings.NewReader("P={'B': {'E': -0.1},\n 'S': {'S': -0.2}}"),
+		strings.NewReader(`P={'B': {'一': -3.5, '我': -2.0}, 'E': {"们": -1.0}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.start['B'] != -0.5 || m.start['S'] != -1.0 {
+		t.Fatal(m.start)
+	}
+	if m.trans['B']['E'] != -0.1 || m.trans['S']['S'] != -0.2 {
+		t.Fatal(m.trans)
+	}
+	if m.emit['B']['一'] != -3.5 || m.emit['B']['我'] != -2.0 || m.emit['E']['们'] != -1.0 {
+		t.Fatal(m.emit)
+	}
+	result := chanToArray(m.Cut("我们"))
+	if len(result) != 1 || result[0] != "我们" {
+		t.Fatal(result)
+	}
+
+	_, err = LoadModel(
+		strings.NewReader("P={'X': -0.5}"),
+		strings.NewReader("P={}"),
+		strings.NewReader("P={}"))
+	if err == nil {
+		t.Fatal("expected an error for invalid state")
+	}
+}
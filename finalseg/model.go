@@ -0,0 +1,161 @@
+package finalseg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Model is a Hidden Markov Model with the probabilities of start states,
+// state transitions and emissions, in logarithm. The states are 'B', 'M',
+// 'E' and 'S', meaning the begin, middle and end of a word, or a single
+// character word.
+type Model struct {
+	start map[byte]float64
+	trans map[byte]map[byte]float64
+	emit  map[byte]map[rune]float64
+}
+
+var defaultModel = &Model{start: probStart, trans: probTrans, emit: probEmit}
+
+/*
+LoadModel reads the three probability tables of a Hidden Markov Model in
+jieba's format, i.e. the content of prob_start.py, prob_trans.py and
+prob_emit.py in jieba's finalseg module, for example:
+
+	P={'B': -0.26268660809250016, 'E': -3.14e+100, 'M': -3.14e+100, 'S': -1.4652633398537678}
+
+Tables in JSON are accepted too. Missing probabilities are treated as
+impossible.
+*/
+func LoadModel(startProb, transProb, emitProb io.Reader) (*Model, error) {
+	var start map[string]float64
+	if err := decodeTable(startProb, &start); err != nil {
+		return nil, fmt.Errorf("finalseg: start probabilities: %v", err)
+	}
+	var trans map[string]map[string]float64
+	if err := decodeTable(transProb, &trans); err != nil {
+		return nil, fmt.Errorf("finalseg: transition probabilities: %v", err)
+	}
+	var emit map[string]map[string]float64
+	if err := decodeTable(emitProb, &emit); err != nil {
+		return nil, fmt.Errorf("finalseg: emission probabilities: %v", err)
+	}
+
+	m := &Model{
+		start: make(map[byte]float64),
+		trans: make(map[byte]map[byte]float64),
+		emit:  make(map[byte]map[rune]float64),
+	}
+	for k, v := range start {
+		y, err := state(k)
+		if err != nil {
+			return nil, fmt.Errorf("finalseg: start probabilities: %v", err)
+		}
+		m.start[y] = v
+	}
+	for k0, vs := range trans {
+		y0, err := state(k0)
+		if err != nil {
+			return nil, fmt.Errorf("finalseg: transition probabilities: %v", err)
+		}
+		m.trans[y0] = make(map[byte]float64)
+		for k, v := range vs {
+			y, err := state(k)
+			if err != nil {
+				return nil, fmt.Errorf("finalseg: transition probabilities: %v", err)
+			}
+			m.trans[y0][y] = v
+		}
+	}
+	for k, vs := range emit {
+		y, err := state(k)
+		if err != nil {
+			return nil, fmt.Errorf("finalseg: emission probabilities: %v", err)
+		}
+		m.emit[y] = make(map[rune]float64)
+		for c, v := range vs {
+			r, size := utf8.DecodeRuneInString(c)
+			if size == 0 || size != len(c) {
+				return nil, fmt.Errorf("finalseg: emission probabilities: invalid character %q", c)
+			}
+			m.emit[y][r] = v
+		}
+	}
+	return m, nil
+}
+
+func state(s string) (byte, error) {
+	switch s {
+	case "B", "M", "E", "S":
+		return s[0], nil
+	}
+	return 0, fmt.Errorf("invalid state %q", s)
+}
+
+// decodeTable decodes a Python dict literal, optionally assigned to a
+// variable like "P={...}", into v.
+func decodeTable(r io.Reader, v interface{}) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s := string(data)
+	begin := strings.IndexByte(s, '{')
+	if begin < 0 {
+		return fmt.Errorf("no table found")
+	}
+	js, err := pythonToJSON(s[begin:])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(js), v)
+}
+
+// pythonToJSON rewrites all the Python string literals in s to JSON strings,
+// everything else is kept as is.
+func pythonToJSON(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		quote := s[i]
+		if quote != '\'' && quote != '"' {
+			b.WriteByte(quote)
+			continue
+		}
+		j := i + 1
+		for ; j < len(s) && s[j] != quote; j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+		if j >= len(s) {
+			return "", fmt.Errorf("unterminated string at offset %d", i)
+		}
+		var content strings.Builder
+		for k := i + 1; k < j; k++ {
+			switch c := s[k]; {
+			case c == '\\' && s[k+1] == '\'':
+				content.WriteByte('\'')
+				k++
+			case c == '\\':
+				content.WriteString(s[k : k+2])
+				k++
+			case c == '"':
+				content.WriteString(`\"`)
+			default:
+				content.WriteByte(c)
+			}
+		}
+		text, err := strconv.Unquote(`"` + content.String() + `"`)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s[i:j+1])
+		}
+		quoted, _ := json.Marshal(text)
+		b.Write(quoted)
+		i = j
+	}
+	return b.String(), nil
+}
@@ -49,15 +49,19 @@ func (ps probStates) Swap(i, j int) {
 	ps[i], ps[j] = ps[j], ps[i]
 }
 
-func viterbi(obs []rune, states []byte) (float64, []byte) {
+func (m *Model) viterbi(obs []rune, states []byte) (float64, []byte) {
 	path := make(map[byte][]byte)
 	V := make([]map[byte]float64, len(obs))
 	V[0] = make(map[byte]float64)
 	for _, y := range states {
-		if val, ok := probEmit[y][obs[0]]; ok {
-			V[0][y] = val + probStart[y]
+		startP, ok := m.start[y]
+		if !ok {
+			startP = minFloat
+		}
+		if val, ok := m.emit[y][obs[0]]; ok {
+			V[0][y] = val + startP
 		} else {
-			V[0][y] = minFloat + probStart[y]
+			V[0][y] = minFloat + startP
 		}
 		path[y] = []byte{y}
 	}
@@ -68,14 +72,14 @@ func viterbi(obs []rune, states []byte) (float64, []byte) {
 		for _, y := range states {
 			ps0 := make(probStates, 0)
 			var emP float64
-			if val, ok := probEmit[y][obs[t]]; ok {
+			if val, ok := m.emit[y][obs[t]]; ok {
 				emP = val
 			} else {
 				emP = minFloat
 			}
 			for _, y0 := range prevStatus[y] {
 				var transP float64
-				if tp, ok := probTrans[y0][y]; ok {
+				if tp, ok := m.trans[y0][y]; ok {
 					transP = tp
 				} else {
 					transP = minFloat
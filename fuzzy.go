@@ -0,0 +1,93 @@
+package jiebago
+
+import "unicode/utf8"
+
+// Fuzzy matching tries spans of minFuzzyLen to maxFuzzyLen runes.
+const (
+	minFuzzyLen = 2
+	maxFuzzyLen = 4
+)
+
+// deleteRune returns runes without the i-th one as a string.
+func deleteRune(runes []rune, i int) string {
+	return string(runes[:i]) + string(runes[i+1:])
+}
+
+// substitutes reports whether a and b have the same number of runes and
+// differ in exactly one of them.
+func substitutes(a, b string) bool {
+	diff := 0
+	for len(a) > 0 && len(b) > 0 {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			diff++
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return len(a) == 0 && len(b) == 0 && diff == 1
+}
+
+// fuzzyFrequency returns the highest frequency of the dictionary words of at
+// least two runes within edit distance 1 of span, or 0 if there is no such
+// word. The caller must hold the read lock of d.
+func (d *Dictionary) fuzzyFrequency(span string, deletes map[string][]string) float64 {
+	runes := []rune(span)
+	best := 0.0
+	// words with one more rune than span
+	for _, word := range deletes[span] {
+		if freq := d.freqMap[word]; freq > best {
+			best = freq
+		}
+	}
+	for i := range runes {
+		key := deleteRune(runes, i)
+		// words with one less rune than span
+		if len(runes) > minFuzzyLen {
+			if freq := d.freqMap[key]; freq > best {
+				best = freq
+			}
+		}
+		// words with one rune different from span
+		for _, word := range deletes[key] {
+			if freq := d.freqMap[word]; freq > best && substitutes(span, word) {
+				best = freq
+			}
+		}
+	}
+	return best
+}
+
+// fuzzyDAG adds the spans of minFuzzyLen to maxFuzzyLen runes within edit
+// distance 1 of a dictionary word to dag, only at the positions where no
+// dictionary word longer than one rune starts. The frequencies of the added
+// spans are stored in sc.fuzzy.
+func (seg *Segmenter) fuzzyDAG(sentence string, offsets []int, dag [][]int, sc *scratch) {
+	for key := range sc.fuzzy {
+		delete(sc.fuzzy, key)
+	}
+	deletes := seg.dict.fuzzyIndex()
+	n := len(offsets) - 1
+	seg.dict.RLock()
+	for k := 0; k < n; k++ {
+		if len(dag[k]) != 1 || dag[k][0] != k {
+			continue
+		}
+		maxLen := maxFuzzyLen
+		if seg.MaxWordLen > 0 && seg.MaxWordLen < maxLen {
+			maxLen = seg.MaxWordLen
+		}
+		for l := minFuzzyLen; l <= maxLen && k+l <= n; l++ {
+			freq := seg.dict.fuzzyFrequency(sentence[offsets[k]:offsets[k+l]], deletes)
+			if freq <= 0 {
+				continue
+			}
+			if sc.fuzzy == nil {
+				sc.fuzzy = make(map[[2]int]float64)
+			}
+			dag[k] = append(dag[k], k+l-1)
+			sc.fuzzy[[2]int{k, k + l - 1}] = freq
+		}
+	}
+	seg.dict.RUnlock()
+}
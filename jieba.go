@@ -2,9 +2,17 @@
 package jiebago
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"math"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/kricen/jiebago/dictionary"
 	"github.com/kricen/jiebago/finalseg"
@@ -22,21 +30,213 @@ var (
 // Segmenter is a Chinese words segmentation struct.
 type Segmenter struct {
 	dict *Dictionary
+	// hmm is the model loaded by LoadHMM, nil means the built-in one.
+	hmm *finalseg.Model
+	// protect holds the patterns added by AddProtectPattern, it is copied on
+	// write so that pinned Segmenters could share it.
+	protect []*regexp.Regexp
+	// mu guards dict, hmm and protect, which could be replaced while cutting.
+	mu sync.RWMutex
+
+	// NormalizeWidth converts full-width ASCII variants, e.g. "ＡＢＣ１２３",
+	// to half-width forms before cutting, the words are emitted in
+	// half-width forms too.
+	NormalizeWidth bool
+	// ConvertTraditional converts common Traditional Chinese characters to
+	// Simplified forms before cutting, so that they match a Simplified
+	// dictionary, the words are emitted in Simplified forms too. The
+	// conversion is character by character, see util.ToSimplified.
+	ConvertTraditional bool
+	// MergeEnglishPhrases merges English words separated by a single space,
+	// e.g. "machine", " ", "learning", into one word "machine learning" in
+	// Cut, if the joined form is found in the dictionary. Since dictionary
+	// files separate fields by spaces, such phrases have to be added by
+	// AddWord. Phrases of more than two words are merged one word at a time,
+	// so every prefix of them must be found in the dictionary too.
+	MergeEnglishPhrases bool
+	// LowercaseOutput lowercases ASCII letters of every word emitted by Cut,
+	// e.g. "OpenAI" is emitted as "openai", other runes are kept as is. It is
+	// applied after the dictionary lookups, so the dictionary words keep
+	// their original case.
+	LowercaseOutput bool
+	// FuzzyMatch tolerates typos in Cut: at every position where no
+	// dictionary word longer than one rune starts, spans of 2 to 4 runes
+	// within edit distance 1 of a dictionary word, i.e. with one rune
+	// inserted, deleted or replaced, are taken as words weighted the
+	// frequency of the most frequent such word. The words are emitted as they
+	// are in the sentence. It is expensive, the index used for matching is
+	// built on first use and rebuilt whenever words are added.
+	FuzzyMatch bool
+	// MaxWordLen is the maximum number of runes of a dictionary word, longer
+	// words are treated as absent while cutting in any mode, so that the text
+	// falls back to shorter words. It is a safety valve for untrusted
+	// dictionaries. Zero means unlimited.
+	MaxWordLen int
+	// TrimTokens trims leading and trailing white spaces of every word
+	// emitted by Cut, the same way TagExtracter does before counting, and
+	// skips words which are empty after trimming, so that no white space is
+	// emitted. By default words are emitted as they are, including the white
+	// spaces between them.
+	TrimTokens bool
+}
+
+func (seg *Segmenter) dictionary() *Dictionary {
+	seg.mu.RLock()
+	d := seg.dict
+	seg.mu.RUnlock()
+	return d
+}
+
+func (seg *Segmenter) setDictionary(d *Dictionary) {
+	seg.mu.Lock()
+	seg.dict = d
+	seg.mu.Unlock()
+}
+
+// pinned returns a Segmenter using current dictionary, so that one cutting
+// always sees the same dictionary even if it is replaced meanwhile.
+func (seg *Segmenter) pinned() *Segmenter {
+	seg.mu.RLock()
+	p := &Segmenter{dict: seg.dict, hmm: seg.hmm, protect: seg.protect,
+		NormalizeWidth: seg.NormalizeWidth, ConvertTraditional: seg.ConvertTraditional,
+		MergeEnglishPhrases: seg.MergeEnglishPhrases, LowercaseOutput: seg.LowercaseOutput,
+		FuzzyMatch: seg.FuzzyMatch, MaxWordLen: seg.MaxWordLen, TrimTokens: seg.TrimTokens}
+	seg.mu.RUnlock()
+	return p
+}
+
+// LoadHMM loads a Hidden Markov Model used to cut unknown words, replacing
+// the built-in one. The start, transition and emission probabilities are
+// read in jieba's format, see finalseg.LoadModel for details. The current
+// model is kept if any error occurs.
+func (seg *Segmenter) LoadHMM(startProb, transProb, emitProb io.Reader) error {
+	m, err := finalseg.LoadModel(startProb, transProb, emitProb)
+	if err != nil {
+		return err
+	}
+	seg.mu.Lock()
+	seg.hmm = m
+	seg.mu.Unlock()
+	return nil
+}
+
+// AddProtectPattern adds a pattern whose matches are never cutted, Cut emits
+// every match as a single word regardless of the dictionary, for example
+// URLs, email addresses or hashtags. If matches of several patterns overlap,
+// the leftmost one wins, and the longest one among those starting at the same
+// position. Matches spanning several lines are split at the newlines.
+// Patterns are applied after NormalizeWidth and ConvertTraditional.
+func (seg *Segmenter) AddProtectPattern(re *regexp.Regexp) {
+	seg.mu.Lock()
+	protect := make([]*regexp.Regexp, len(seg.protect), len(seg.protect)+1)
+	copy(protect, seg.protect)
+	seg.protect = append(protect, re)
+	seg.mu.Unlock()
 }
 
-// Frequency returns a word's frequency and existence
+// protectedSpans returns the byte offsets of all the non-overlapping matches
+// of the protect patterns in sentence, sorted by position.
+func (seg *Segmenter) protectedSpans(sentence string) [][]int {
+	var spans [][]int
+	for _, re := range seg.protect {
+		for _, loc := range re.FindAllStringIndex(sentence, -1) {
+			if loc[1] > loc[0] {
+				spans = append(spans, loc)
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i][0] == spans[j][0] {
+			return spans[i][1] > spans[j][1]
+		}
+		return spans[i][0] < spans[j][0]
+	})
+	end := 0
+	var result [][]int
+	for _, span := range spans {
+		if span[0] < end {
+			continue
+		}
+		end = span[1]
+		// a match is split at newlines, which are cut as words by
+		// themselves, so that no word spans lines
+		start := span[0]
+		for start < end {
+			i := strings.IndexByte(sentence[start:end], '\n')
+			if i < 0 {
+				result = append(result, []int{start, end})
+				break
+			}
+			line := start + i
+			if line > start && sentence[line-1] == '\r' {
+				line--
+			}
+			if line > start {
+				result = append(result, []int{start, line})
+			}
+			start += i + 1
+		}
+	}
+	return result
+}
+
+// cutHMM cuts sentence with the loaded Hidden Markov Model, or the built-in
+// one if no model has been loaded.
+func (seg *Segmenter) cutHMM(sentence string, emit func(word string) bool) bool {
+	ok := true
+	fn := func(word string) bool {
+		ok = emit(word)
+		return ok
+	}
+	if seg.hmm != nil {
+		seg.hmm.CutFunc(sentence, fn)
+	} else {
+		finalseg.CutFunc(sentence, fn)
+	}
+	return ok
+}
+
+func (seg *Segmenter) normalize(sentence string) string {
+	if seg.NormalizeWidth {
+		sentence = util.NormalizeWidth(sentence)
+	}
+	if seg.ConvertTraditional {
+		sentence = util.ToSimplified(sentence)
+	}
+	return sentence
+}
+
+// Frequency returns a word's frequency and existence. Prefixes of words
+// and deleted words are kept in dictionary with zero frequency, they are
+// reported as not existing. It is safe to call Frequency concurrently.
 func (seg *Segmenter) Frequency(word string) (float64, bool) {
-	return seg.dict.Frequency(word)
+	freq, ok := seg.dictionary().Frequency(word)
+	return freq, ok && freq > 0.0
 }
 
-// AddWord adds a new word with frequency to dictionary
-func (seg *Segmenter) AddWord(word string, frequency float64) {
-	seg.dict.AddToken(dictionary.NewToken(word, frequency, ""))
+// Pos returns a word's POS and existence
+func (seg *Segmenter) Pos(word string) (string, bool) {
+	return seg.dictionary().Pos(word)
+}
+
+// AddWord adds a new word with frequency and optional POS to dictionary.
+// If frequency is not positive, the frequency suggested by SuggestFrequency
+// is used to make sure the word can be cutted out. So AddWord can not apply
+// a suggested frequency of 0, which SuggestFrequency returns for some words
+// to be cutted apart, use SuggestFreq or DeleteWord to cut them apart.
+// It is safe to call AddWord while other goroutines are cutting, words being
+// cutted at the same time may or may not see the new word.
+func (seg *Segmenter) AddWord(word string, frequency float64, pos string) {
+	if frequency <= 0 {
+		frequency = seg.SuggestFrequency(word)
+	}
+	seg.dictionary().AddToken(dictionary.NewToken(word, frequency, pos))
 }
 
-// DeleteWord removes a word from dictionary
+// DeleteWord removes a word from dictionary, it is safe to call DeleteWord
+// while other goroutines are cutting.
 func (seg *Segmenter) DeleteWord(word string) {
-	seg.dict.AddToken(dictionary.NewToken(word, 0.0, ""))
+	seg.dictionary().AddToken(dictionary.NewToken(word, 0.0, ""))
 }
 
 /*
@@ -51,20 +251,24 @@ frequency for this word.
 
 If a word should be further cutted, for example word "今天天气" should be
 further cutted into two words "今天" and "天气",  SuggestFrequency("今天", "天气")
-should return the minimum frequency for word "今天天气".
+should return the minimum frequency for word "今天天气". The minimum frequency
+could be 0, which AddWord treats as asking for a suggestion to keep the word
+together, use SuggestFreq to apply it instead.
 */
 func (seg *Segmenter) SuggestFrequency(words ...string) float64 {
+	d := seg.dictionary()
+	total, _ := d.totals()
 	frequency := 1.0
 	if len(words) > 1 {
 		for _, word := range words {
-			if freq, ok := seg.dict.Frequency(word); ok {
+			if freq, ok := d.Frequency(word); ok {
 				frequency *= freq
 			}
-			frequency /= seg.dict.total
+			frequency /= total
 		}
-		frequency, _ = math.Modf(frequency * seg.dict.total)
+		frequency, _ = math.Modf(frequency * total)
 		wordFreq := 0.0
-		if freq, ok := seg.dict.Frequency(strings.Join(words, "")); ok {
+		if freq, ok := d.Frequency(strings.Join(words, "")); ok {
 			wordFreq = freq
 		}
 		if wordFreq < frequency {
@@ -73,15 +277,15 @@ func (seg *Segmenter) SuggestFrequency(words ...string) float64 {
 	} else {
 		word := words[0]
 		for segment := range seg.Cut(word, false) {
-			if freq, ok := seg.dict.Frequency(segment); ok {
+			if freq, ok := d.Frequency(segment); ok {
 				frequency *= freq
 			}
-			frequency /= seg.dict.total
+			frequency /= total
 		}
-		frequency, _ = math.Modf(frequency * seg.dict.total)
+		frequency, _ = math.Modf(frequency * total)
 		frequency += 1.0
 		wordFreq := 1.0
-		if freq, ok := seg.dict.Frequency(word); ok {
+		if freq, ok := d.Frequency(word); ok {
 			wordFreq = freq
 		}
 		if wordFreq > frequency {
@@ -91,47 +295,285 @@ func (seg *Segmenter) SuggestFrequency(words ...string) float64 {
 	return frequency
 }
 
+// SuggestFreq works like SuggestFrequency, but also applies the suggested
+// frequency to the joined word, so SuggestFreq("台中") keeps "台中" together
+// and SuggestFreq("中", "将") cuts "中将" apart. It returns the new frequency.
+func (seg *Segmenter) SuggestFreq(segment ...string) float64 {
+	frequency := seg.SuggestFrequency(segment...)
+	seg.dictionary().AddToken(dictionary.NewToken(strings.Join(segment, ""), frequency, ""))
+	return frequency
+}
+
 // LoadDictionary loads dictionary from given file name. Everytime
 // LoadDictionary is called, previously loaded dictionary will be cleard.
 func (seg *Segmenter) LoadDictionary(fileName string) error {
-	seg.dict = &Dictionary{freqMap: make(map[string]float64)}
-	return seg.dict.loadDictionary(fileName)
+	d := newDictionary()
+	err := d.loadDictionary(fileName)
+	seg.setDictionary(d)
+	return err
 }
 
-// LoadUserDictionary loads a user specified dictionary, it must be called
+// LoadDictionaries loads and merges the dictionaries from given file names in
+// order, later files override the frequencies and POS of words found in
+// earlier ones. Like Reload, previously loaded dictionary is replaced only
+// if all the files are loaded, the returned error tells which file failed.
+func (seg *Segmenter) LoadDictionaries(fileNames ...string) error {
+	d := newDictionary()
+	for _, fileName := range fileNames {
+		if err := d.loadDictionary(fileName); err != nil {
+			return fmt.Errorf("%s: %v", fileName, err)
+		}
+	}
+	seg.setDictionary(d)
+	return nil
+}
+
+// LoadDictionaryStrict loads dictionary from given file name like
+// LoadDictionary, but returns an error telling the line number and content of
+// the first malformed line, see dictionary.LoadDictionaryStrict. Like Reload,
+// current dictionary is kept if any error occurs.
+func (seg *Segmenter) LoadDictionaryStrict(fileName string) error {
+	d := newDictionary()
+	if err := d.loadDictionaryStrict(fileName); err != nil {
+		return err
+	}
+	seg.setDictionary(d)
+	return nil
+}
+
+// LoadUserDictionary loads a user specified dictionary, it should be called
 // after LoadDictionary, and it will not clear any previous loaded dictionary,
-// instead it will override exist entries.
+// instead it will merge into it and override exist entries' frequency and POS.
 func (seg *Segmenter) LoadUserDictionary(fileName string) error {
-	return seg.dict.loadDictionary(fileName)
+	return seg.userDictionary().loadDictionary(fileName)
+}
+
+/*
+LoadUserDictionaryScaled loads a user specified dictionary like
+LoadUserDictionary, but multiplies the frequencies of the user words by scale
+before merging them, so that a user dictionary counted on a different scale
+behaves sensibly relative to the main one.
+
+If scale is not positive, it is computed from both dictionaries as
+
+	scale = (mainTotal / mainCount) / (userTotal / userCount)
+
+where total is the sum of the frequencies and count is the number of words
+with positive frequency, i.e. the mean frequency of the user words is scaled
+to the mean frequency of the words already loaded. The scale is 1 if either
+dictionary is empty.
+*/
+func (seg *Segmenter) LoadUserDictionaryScaled(fileName string, scale float64) error {
+	var tokens tokenList
+	err := dictionary.LoadDictionary(&tokens, fileName)
+	seg.userDictionary().addScaled(tokens, scale)
+	return err
+}
+
+// LoadDictionaryReader loads dictionary from given reader, for example an
+// opened embed.FS file or an in-memory buffer. Like LoadDictionary,
+// previously loaded dictionary will be cleard.
+func (seg *Segmenter) LoadDictionaryReader(r io.Reader) error {
+	d := newDictionary()
+	err := d.loadDictionaryReader(r)
+	seg.setDictionary(d)
+	return err
+}
+
+// LoadUserDictionaryReader loads a user specified dictionary from given
+// reader, see LoadUserDictionary for details.
+func (seg *Segmenter) LoadUserDictionaryReader(r io.Reader) error {
+	return seg.userDictionary().loadDictionaryReader(r)
+}
+
+// DictStats returns the total frequency of current dictionary, which is the
+// denominator of word probabilities used by Cut, and the number of words with
+// positive frequency. Both are zero if no dictionary is loaded.
+func (seg *Segmenter) DictStats() (totalFreq float64, wordCount int) {
+	d := seg.dictionary()
+	if d == nil {
+		return 0, 0
+	}
+	return d.Stats()
+}
+
+// TopWords returns the k most frequent words in current dictionary, the
+// weight of every word is its frequency. Words with the same frequency are
+// ordered by text. If k is negative all the words are returned.
+func (seg *Segmenter) TopWords(k int) []WeightedToken {
+	d := seg.dictionary()
+	if d == nil || k == 0 {
+		return []WeightedToken{}
+	}
+	tokens := d.tokens()
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].Frequency() > tokens[j].Frequency()
+	})
+	if k > 0 && k < len(tokens) {
+		tokens = tokens[:k]
+	}
+	words := make([]WeightedToken, len(tokens))
+	for i, token := range tokens {
+		words[i] = WeightedToken{Text: token.Text(), Weight: token.Frequency()}
+	}
+	return words
+}
+
+// WordsWithPrefix returns at most limit words in current dictionary starting
+// with prefix, sorted by descending frequency, words with the same frequency
+// are ordered by text. It is meant for autocompletion. If limit is negative
+// all the matching words are returned, if no word matches an empty slice is
+// returned. The words are found by binary search in a sorted index of the
+// dictionary, which is built on first use and after words are added.
+func (seg *Segmenter) WordsWithPrefix(prefix string, limit int) []string {
+	d := seg.dictionary()
+	if d == nil || limit == 0 {
+		return []string{}
+	}
+	tokens := d.withPrefix(prefix)
+	if limit > 0 && limit < len(tokens) {
+		tokens = tokens[:limit]
+	}
+	words := make([]string, len(tokens))
+	for i, token := range tokens {
+		words[i] = token.Text()
+	}
+	return words
+}
+
+// SaveDictionary writes current dictionary, including words added by AddWord
+// or SuggestFreq, to the given writer sorted by word. The output can be
+// loaded back by LoadDictionary or LoadDictionaryReader.
+func (seg *Segmenter) SaveDictionary(w io.Writer) error {
+	d := seg.dictionary()
+	if d == nil {
+		return nil
+	}
+	return dictionary.WriteDictionary(w, d.tokens())
+}
+
+// userDictionary returns current dictionary, an empty one is created if no
+// dictionary has been loaded.
+func (seg *Segmenter) userDictionary() *Dictionary {
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+	if seg.dict == nil {
+		seg.dict = newDictionary()
+	}
+	return seg.dict
+}
+
+/*
+Reload replaces current dictionary with the one loaded from given file name.
+
+Unlike LoadDictionary, the new dictionary is fully loaded before replacing
+the current one, and the current one is kept if any error occurs. It is safe
+to call Reload while other goroutines are cutting: every Cut, CutAll,
+CutForSearch or Tokenize call sees either the old or the new dictionary for
+its whole run, never a mix of them.
+*/
+func (seg *Segmenter) Reload(fileName string) error {
+	d := newDictionary()
+	if err := d.loadDictionary(fileName); err != nil {
+		return err
+	}
+	seg.setDictionary(d)
+	return nil
+}
+
+// ReloadReader replaces current dictionary with the one loaded from given
+// reader, see Reload for details.
+func (seg *Segmenter) ReloadReader(r io.Reader) error {
+	d := newDictionary()
+	if err := d.loadDictionaryReader(r); err != nil {
+		return err
+	}
+	seg.setDictionary(d)
+	return nil
+}
+
+// scratch holds the buffers used to cut one block of text, it is reused
+// through scratchPool to reduce allocations. A scratch must not be shared
+// by goroutines.
+type scratch struct {
+	offsets []int
+	dag     [][]int
+	routes  []route
+	// fuzzy holds the frequencies of the spans added by fuzzyDAG, keyed by
+	// their start and end rune indexes.
+	fuzzy map[[2]int]float64
 }
 
-func (seg *Segmenter) dag(runes []rune) map[int][]int {
-	dag := make(map[int][]int)
-	n := len(runes)
-	var frag []rune
-	var i int
+var scratchPool = sync.Pool{New: func() interface{} { return new(scratch) }}
+
+// index returns sentence in valid UTF-8 together with the byte offset of
+// every rune in it, offsets[n] is the length of the string, where n is the
+// number of runes. Invalid bytes are replaced by utf8.RuneError, the same
+// as converting sentence to runes.
+func (sc *scratch) index(sentence string) (string, []int) {
+	if !utf8.ValidString(sentence) {
+		sentence = string([]rune(sentence))
+	}
+	offsets := sc.offsets[:0]
+	for i := range sentence {
+		offsets = append(offsets, i)
+	}
+	sc.offsets = append(offsets, len(sentence))
+	return sentence, sc.offsets
+}
+
+// dag returns the directed acyclic graph of all the words in sentence,
+// dag[k] holds the end rune indexes of the words starting at rune k, words
+// longer than MaxWordLen are skipped.
+// Fragments are looked up as substrings of sentence under one read lock, so
+// that no string is allocated for every lookup. The slices in buf are reused
+// if buf is not nil.
+func (seg *Segmenter) dag(sentence string, offsets []int, buf [][]int) [][]int {
+	n := len(offsets) - 1
+	if cap(buf) < n {
+		buf = append(buf[:cap(buf)], make([][]int, n-cap(buf))...)
+	}
+	dag := buf[:n]
+	seg.dict.RLock()
 	for k := 0; k < n; k++ {
-		dag[k] = make([]int, 0)
-		i = k
-		frag = runes[k : k+1]
-		for {
-			freq, ok := seg.dict.Frequency(string(frag))
+		dag[k] = dag[k][:0]
+		last := n - 1
+		if seg.MaxWordLen > 0 && k+seg.MaxWordLen-1 < last {
+			last = k + seg.MaxWordLen - 1
+		}
+		for i := k; i <= last; i++ {
+			freq, ok := seg.dict.freqMap[sentence[offsets[k]:offsets[i+1]]]
 			if !ok {
 				break
 			}
 			if freq > 0.0 {
 				dag[k] = append(dag[k], i)
 			}
-			i++
-			if i >= n {
-				break
-			}
-			frag = runes[k : i+1]
 		}
 		if len(dag[k]) == 0 {
 			dag[k] = append(dag[k], k)
 		}
 	}
+	seg.dict.RUnlock()
+	return dag
+}
+
+// BuildDAG returns the directed acyclic graph built for sentence, the same
+// one used by Cut to choose the words. For every start rune index, it holds
+// the end rune indexes (inclusive) of all the dictionary words starting
+// there, or the start index itself if there is no such word.
+func (seg *Segmenter) BuildDAG(sentence string) map[int][]int {
+	s := seg.pinned()
+	sc := new(scratch)
+	text, offsets := sc.index(s.normalize(sentence))
+	ends := s.dag(text, offsets, nil)
+	if s.FuzzyMatch {
+		s.fuzzyDAG(text, offsets, ends, sc)
+	}
+	dag := make(map[int][]int, len(ends))
+	for k := range ends {
+		dag[k] = ends[k]
+	}
 	return dag
 }
 
@@ -140,196 +582,730 @@ type route struct {
 	index     int
 }
 
-func (seg *Segmenter) calc(runes []rune) map[int]route {
-	dag := seg.dag(runes)
-	n := len(runes)
-	rs := make(map[int]route)
+// calc returns the best route of sentence indexed by sc.index, the returned
+// slice is owned by sc.
+// The probabilities are summed up in log space, so long sentences of rare
+// words never underflow. Single runes not in the dictionary, or only known
+// as prefixes of longer words, are counted as frequency 1, otherwise their
+// log probability would be -Inf and all the routes through them would tie.
+func (seg *Segmenter) calc(sentence string, offsets []int, sc *scratch) []route {
+	sc.dag = seg.dag(sentence, offsets, sc.dag)
+	dag := sc.dag
+	fuzzy := seg.FuzzyMatch
+	if fuzzy {
+		seg.fuzzyDAG(sentence, offsets, dag, sc)
+	}
+	n := len(offsets) - 1
+	if cap(sc.routes) < n+1 {
+		sc.routes = make([]route, n+1)
+	}
+	rs := sc.routes[:n+1]
 	rs[n] = route{frequency: 0.0, index: 0}
 	var r route
+	seg.dict.RLock()
+	logTotal := seg.dict.logTotal
 	for idx := n - 1; idx >= 0; idx-- {
-		for _, i := range dag[idx] {
-			if freq, ok := seg.dict.Frequency(string(runes[idx : i+1])); ok {
-				r = route{frequency: math.Log(freq) - seg.dict.logTotal + rs[i+1].frequency, index: i}
+		for j, i := range dag[idx] {
+			if freq := seg.dict.freqMap[sentence[offsets[idx]:offsets[i+1]]]; freq > 0 {
+				r = route{frequency: math.Log(freq) - logTotal + rs[i+1].frequency, index: i}
+			} else if freq, ok := sc.fuzzy[[2]int{idx, i}]; fuzzy && ok {
+				r = route{frequency: math.Log(freq) - logTotal + rs[i+1].frequency, index: i}
 			} else {
-				r = route{frequency: math.Log(1.0) - seg.dict.logTotal + rs[i+1].frequency, index: i}
+				r = route{frequency: math.Log(1.0) - logTotal + rs[i+1].frequency, index: i}
 			}
-			if v, ok := rs[idx]; !ok {
+			if v := rs[idx]; j == 0 || v.frequency < r.frequency || (v.frequency == r.frequency && v.index < r.index) {
 				rs[idx] = r
-			} else {
-				if v.frequency < r.frequency || (v.frequency == r.frequency && v.index < r.index) {
-					rs[idx] = r
-				}
 			}
 		}
 	}
+	seg.dict.RUnlock()
 	return rs
 }
 
-type cutFunc func(sentence string) <-chan string
+// cutFunc cuts sentence and calls emit for every word, it returns false if
+// emit returns false.
+type cutFunc func(sentence string, emit func(word string) bool) bool
 
-func (seg *Segmenter) cutDAG(sentence string) <-chan string {
-	result := make(chan string)
-	go func() {
-		runes := []rune(sentence)
-		routes := seg.calc(runes)
-		var y int
-		length := len(runes)
-		var buf []rune
-		for x := 0; x < length; {
-			y = routes[x].index + 1
-			frag := runes[x:y]
-			if y-x == 1 {
-				buf = append(buf, frag...)
-			} else {
-				if len(buf) > 0 {
-					bufString := string(buf)
-					if len(buf) == 1 {
-						result <- bufString
-					} else {
-						if v, ok := seg.dict.Frequency(bufString); !ok || v == 0.0 {
-							for x := range finalseg.Cut(bufString) {
-								result <- x
-							}
-						} else {
-							for _, elem := range buf {
-								result <- string(elem)
-							}
-						}
-					}
-					buf = make([]rune, 0)
-				}
-				result <- string(frag)
+func (seg *Segmenter) cutDAG(sentence string, emit func(word string) bool) bool {
+	sc := scratchPool.Get().(*scratch)
+	defer scratchPool.Put(sc)
+	sentence, offsets := sc.index(sentence)
+	routes := seg.calc(sentence, offsets, sc)
+	n := len(offsets) - 1
+	// single is the start of the run of single rune words before x, or -1.
+	single := -1
+	for x := 0; x < n; {
+		y := routes[x].index + 1
+		if y-x == 1 {
+			if single < 0 {
+				single = x
 			}
-			x = y
-		}
-
-		if len(buf) > 0 {
-			bufString := string(buf)
-			if len(buf) == 1 {
-				result <- bufString
-			} else {
-				if v, ok := seg.dict.Frequency(bufString); !ok || v == 0.0 {
-					for t := range finalseg.Cut(bufString) {
-						result <- t
-					}
-				} else {
-					for _, elem := range buf {
-						result <- string(elem)
-					}
+		} else {
+			if single >= 0 {
+				if !seg.cutSingles(sentence, offsets, single, x, emit) {
+					return false
 				}
+				single = -1
+			}
+			if !emit(sentence[offsets[x]:offsets[y]]) {
+				return false
 			}
 		}
-		close(result)
-	}()
-	return result
+		x = y
+	}
+	if single >= 0 {
+		return seg.cutSingles(sentence, offsets, single, n, emit)
+	}
+	return true
 }
 
-func (seg *Segmenter) cutDAGNoHMM(sentence string) <-chan string {
-	result := make(chan string)
+// cutSingles emits the run of single rune words from rune start to end, it is
+// passed to the Hidden Markov Model unless it is one rune or a dictionary
+// word.
+func (seg *Segmenter) cutSingles(sentence string, offsets []int, start, end int, emit func(word string) bool) bool {
+	text := sentence[offsets[start]:offsets[end]]
+	if end-start == 1 {
+		return emit(text)
+	}
+	if v, ok := seg.dict.Frequency(text); !ok || v == 0.0 {
+		return seg.cutHMM(text, emit)
+	}
+	for i := start; i < end; i++ {
+		if !emit(sentence[offsets[i]:offsets[i+1]]) {
+			return false
+		}
+	}
+	return true
+}
 
-	go func() {
-		runes := []rune(sentence)
-		routes := seg.calc(runes)
-		var y int
-		length := len(runes)
-		var buf []rune
-		for x := 0; x < length; {
-			y = routes[x].index + 1
-			frag := runes[x:y]
-			if reEng.MatchString(string(frag)) && len(frag) == 1 {
-				buf = append(buf, frag...)
-				x = y
-				continue
-			}
-			if len(buf) > 0 {
-				result <- string(buf)
-				buf = make([]rune, 0)
+func (seg *Segmenter) cutDAGNoHMM(sentence string, emit func(word string) bool) bool {
+	sc := scratchPool.Get().(*scratch)
+	defer scratchPool.Put(sc)
+	sentence, offsets := sc.index(sentence)
+	routes := seg.calc(sentence, offsets, sc)
+	n := len(offsets) - 1
+	// eng is the start of the run of single alphanumeric runes before x, or
+	// -1, such runs are emitted as one word.
+	eng := -1
+	for x := 0; x < n; {
+		y := routes[x].index + 1
+		frag := sentence[offsets[x]:offsets[y]]
+		if y-x == 1 && reEng.MatchString(frag) {
+			if eng < 0 {
+				eng = x
 			}
-			result <- string(frag)
 			x = y
+			continue
 		}
-		if len(buf) > 0 {
-			result <- string(buf)
-			buf = make([]rune, 0)
+		if eng >= 0 {
+			if !emit(sentence[offsets[eng]:offsets[x]]) {
+				return false
+			}
+			eng = -1
 		}
-		close(result)
-	}()
-	return result
+		if !emit(frag) {
+			return false
+		}
+		x = y
+	}
+	if eng >= 0 {
+		return emit(sentence[offsets[eng]:offsets[n]])
+	}
+	return true
 }
 
 // Cut cuts a sentence into words using accurate mode.
 // Parameter hmm controls whether to use the Hidden Markov Model.
 // Accurate mode attempts to cut the sentence into the most accurate
 // segmentations, which is suitable for text analysis.
+// For the same sentence and dictionary, the words are always emitted in the
+// same order. White spaces inside the sentence are emitted as words too, but
+// an empty or whitespace-only sentence gives no words at all and is not
+// cutted. Newlines always end words, every "\n" or "\r\n" is emitted as a
+// word by itself, even inside protected patterns, so no word spans lines.
 func (seg *Segmenter) Cut(sentence string, hmm bool) <-chan string {
-	result := make(chan string)
-	var cut cutFunc
+	if strings.TrimSpace(sentence) == "" {
+		return emptyResult
+	}
+	return seg.pinned().cut(context.Background(), sentence, hmm)
+}
+
+// CutContext cuts a sentence into words like Cut. Once ctx is cancelled, it
+// stops cutting and closes the returned channel, so that the caller could
+// stop draining it without leaking goroutines.
+func (seg *Segmenter) CutContext(ctx context.Context, sentence string, hmm bool) <-chan string {
+	if strings.TrimSpace(sentence) == "" {
+		return emptyResult
+	}
+	return seg.pinned().cut(ctx, sentence, hmm)
+}
+
+// CutBuffered cuts a sentence into words like Cut, but the returned channel
+// buffers up to bufSize words, so that cutting goes on while the consumer is
+// occasionally slow. A non-positive bufSize acts the same as Cut.
+func (seg *Segmenter) CutBuffered(sentence string, hmm bool, bufSize int) <-chan string {
+	if strings.TrimSpace(sentence) == "" {
+		return emptyResult
+	}
+	return seg.pinned().cutBuffered(context.Background(), sentence, hmm, bufSize)
+}
+
+// emptyResult is returned for empty and whitespace-only sentences, which need
+// neither cutting nor a goroutine.
+var emptyResult = func() <-chan string {
+	ch := make(chan string)
+	close(ch)
+	return ch
+}()
+
+// send sends word to ch, it returns false if ctx is done before that.
+func send(ctx context.Context, ch chan<- string, word string) bool {
+	select {
+	case ch <- word:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (seg *Segmenter) cut(ctx context.Context, sentence string, hmm bool) <-chan string {
+	return seg.cutBuffered(ctx, sentence, hmm, 0)
+}
+
+func (seg *Segmenter) cutBuffered(ctx context.Context, sentence string, hmm bool, bufSize int) <-chan string {
+	if bufSize < 0 {
+		bufSize = 0
+	}
+	result := make(chan string, bufSize)
+	go func() {
+		defer close(result)
+		seg.cutWords(sentence, hmm, func(word string) bool {
+			return send(ctx, result, word)
+		})
+	}()
+	return result
+}
+
+// CutFunc cuts a sentence into words like Cut, but calls fn for every word
+// synchronously on the calling goroutine, in the same order as Cut emits
+// them, and stops once fn returns false. Neither goroutines nor channels are
+// involved, which makes it the fastest way to consume the words.
+func (seg *Segmenter) CutFunc(sentence string, hmm bool, fn func(word string) bool) {
+	if strings.TrimSpace(sentence) == "" {
+		return
+	}
+	seg.pinned().cutWords(sentence, hmm, fn)
+}
+
+// cutWords cuts sentence in accurate mode and calls emit for every word, it
+// stops once emit returns false.
+func (seg *Segmenter) cutWords(sentence string, hmm bool, emit func(word string) bool) {
+	if seg.TrimTokens {
+		next := emit
+		emit = func(word string) bool {
+			if word = strings.TrimSpace(word); word == "" {
+				return true
+			}
+			return next(word)
+		}
+	}
+	if seg.LowercaseOutput {
+		next := emit
+		emit = func(word string) bool {
+			return next(lowerASCII(word))
+		}
+	}
+	var flush func() bool
+	if seg.MergeEnglishPhrases {
+		emit, flush = seg.mergeEnglish(emit)
+	}
+	cut := seg.cutDAGNoHMM
 	if hmm {
 		cut = seg.cutDAG
-	} else {
-		cut = seg.cutDAGNoHMM
 	}
 
-	go func() {
-		for _, block := range util.RegexpSplit(reHanDefault, sentence, -1) {
-			if len(block) == 0 {
-				continue
+	sentence = seg.normalize(sentence)
+	start := 0
+	for _, span := range seg.protectedSpans(sentence) {
+		if !cutText(sentence[start:span[0]], cut, emit) {
+			return
+		}
+		if !emit(sentence[span[0]:span[1]]) {
+			return
+		}
+		start = span[1]
+	}
+	if cutText(sentence[start:], cut, emit) && flush != nil {
+		flush()
+	}
+}
+
+// lowerASCII returns word with ASCII letters lowercased, other runes are
+// kept as is, see LowercaseOutput.
+func lowerASCII(word string) string {
+	i := 0
+	for ; i < len(word); i++ {
+		if c := word[i]; c >= 'A' && c <= 'Z' {
+			break
+		}
+	}
+	if i == len(word) {
+		return word
+	}
+	b := []byte(word)
+	for ; i < len(b); i++ {
+		if c := b[i]; c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// isEnglish reports whether word is made of ASCII letters only.
+func isEnglish(word string) bool {
+	if len(word) == 0 {
+		return false
+	}
+	for i := 0; i < len(word); i++ {
+		if c := word[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeEnglish returns a function passing words to emit, which merges
+// English words separated by a single space if the joined form is found in
+// the dictionary, see MergeEnglishPhrases. The returned flush function must
+// be called after the last word.
+func (seg *Segmenter) mergeEnglish(emit func(word string) bool) (merge func(word string) bool, flush func() bool) {
+	// pending holds an English word or phrase, optionally followed by a
+	// space, which might be merged with the next words.
+	var pending []string
+	flush = func() bool {
+		for _, word := range pending {
+			if !emit(word) {
+				return false
 			}
-			if reHanDefault.MatchString(block) {
-				for x := range cut(block) {
-					result <- x
+		}
+		pending = pending[:0]
+		return true
+	}
+	merge = func(word string) bool {
+		switch {
+		case len(pending) == 1 && word == " ":
+			pending = append(pending, word)
+			return true
+		case len(pending) == 2 && isEnglish(word):
+			phrase := pending[0] + " " + word
+			if freq, ok := seg.dict.Frequency(phrase); ok && freq > 0 {
+				pending = append(pending[:0], phrase)
+				return true
+			}
+		}
+		if !flush() {
+			return false
+		}
+		if isEnglish(word) {
+			pending = append(pending, word)
+			return true
+		}
+		return emit(word)
+	}
+	return merge, flush
+}
+
+// cutText cuts text with cut and calls emit for every word, it returns false
+// if emit returns false.
+func cutText(text string, cut cutFunc, emit func(word string) bool) bool {
+	for _, block := range util.RegexpSplit(reHanDefault, text, -1) {
+		if len(block) == 0 {
+			continue
+		}
+		if reHanDefault.MatchString(block) {
+			if !cut(block, emit) {
+				return false
+			}
+			continue
+		}
+		for _, subBlock := range util.RegexpSplit(reSkipDefault, block, -1) {
+			if reSkipDefault.MatchString(subBlock) {
+				if !emit(subBlock) {
+					return false
 				}
 				continue
 			}
-			for _, subBlock := range util.RegexpSplit(reSkipDefault, block, -1) {
-				if reSkipDefault.MatchString(subBlock) {
-					result <- subBlock
-					continue
-				}
-				for _, r := range subBlock {
-					result <- string(r)
+			for _, r := range subBlock {
+				if !emit(string(r)) {
+					return false
 				}
 			}
 		}
-		close(result)
-	}()
-	return result
+	}
+	return true
 }
 
-func (seg *Segmenter) cutAll(sentence string) <-chan string {
+// CutNoHMM cuts a sentence into words using accurate mode without the Hidden
+// Markov Model, it is the same as Cut(sentence, false). Words not found in
+// dictionary are never passed to the Viterbi algorithm, which makes it faster
+// than Cut(sentence, true).
+func (seg *Segmenter) CutNoHMM(sentence string) <-chan string {
+	return seg.Cut(sentence, false)
+}
+
+// CutToSlice cuts a sentence into words using accurate mode, like Cut, but
+// returns all the words in a slice, in the same order.
+func (seg *Segmenter) CutToSlice(sentence string, hmm bool) []string {
+	var words []string
+	seg.CutFunc(sentence, hmm, func(word string) bool {
+		words = append(words, word)
+		return true
+	})
+	return words
+}
+
+// CutJoin cuts a sentence into words using accurate mode, like Cut, and
+// joins the words with sep, e.g. "我/来到/北京/清华大学" with sep "/", which
+// is handy for debugging and logging. All the words are joined, including
+// punctuations and white spaces.
+func (seg *Segmenter) CutJoin(sentence string, hmm bool, sep string) string {
+	var b strings.Builder
+	seg.CutFunc(sentence, hmm, func(word string) bool {
+		if b.Len() > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(word)
+		return true
+	})
+	return b.String()
+}
+
+// CutCompare cuts a sentence using accurate mode both with and without the
+// Hidden Markov Model, like CutToSlice, and reports whether the two
+// segmentations differ, which tells whether HMM finds new words in it.
+func (seg *Segmenter) CutCompare(sentence string) (withHMM, withoutHMM []string, differ bool) {
+	s := seg.pinned()
+	withHMM = s.CutToSlice(sentence, true)
+	withoutHMM = s.CutToSlice(sentence, false)
+	if len(withHMM) != len(withoutHMM) {
+		return withHMM, withoutHMM, true
+	}
+	for i := range withHMM {
+		if withHMM[i] != withoutHMM[i] {
+			return withHMM, withoutHMM, true
+		}
+	}
+	return withHMM, withoutHMM, false
+}
+
+// TokenSource is a word with whether it is found in the dictionary, words
+// not found are cut out by the Hidden Markov Model or are single runes,
+// numbers, English words, punctuations, etc.
+type TokenSource struct {
+	Text     string
+	FromDict bool
+}
+
+// CutWithSource cuts a sentence into words using accurate mode, like Cut, and
+// reports whether every word is found in the dictionary used for cutting.
+func (seg *Segmenter) CutWithSource(sentence string, hmm bool) []TokenSource {
+	s := seg.pinned()
+	var tokens []TokenSource
+	for word := range s.Cut(sentence, hmm) {
+		freq, ok := s.dict.Frequency(word)
+		tokens = append(tokens, TokenSource{Text: word, FromDict: ok && freq > 0.0})
+	}
+	return tokens
+}
+
+// WeightedToken is a word with its frequency in the dictionary.
+type WeightedToken struct {
+	Text   string
+	Weight float64
+}
+
+// CutWithWeights cuts a sentence into words using accurate mode, like Cut,
+// and pairs every word with its frequency in the dictionary used for
+// cutting, or the median frequency of the dictionary if the word is not
+// found, which is a rough importance of the word.
+func (seg *Segmenter) CutWithWeights(sentence string, hmm bool) []WeightedToken {
+	s := seg.pinned()
+	var tokens []WeightedToken
+	for word := range s.Cut(sentence, hmm) {
+		freq, ok := s.dict.Frequency(word)
+		if !ok || freq <= 0.0 {
+			freq = s.dict.Median()
+		}
+		tokens = append(tokens, WeightedToken{Text: word, Weight: freq})
+	}
+	return tokens
+}
+
+// CutWithScore cuts a sentence into words using accurate mode, like Cut, and
+// returns a confidence score of the segmentation, which is the log
+// probability of the words, the sum of log(frequency / total frequency) of
+// every word, divided by the number of runes in sentence. Words not in the
+// dictionary, like those cut out by the Hidden Markov Model, English words
+// and punctuations, are counted as frequency 1, the same as the route
+// algorithm does for unknown runes. The score is never positive, the closer
+// it is to 0 the more confident the segmentation is, sentences of ambiguous
+// or unknown words score lower. Since the score depends on the total
+// frequency, it is only comparable between sentences cut with the same
+// dictionary. An empty sentence scores 0.
+func (seg *Segmenter) CutWithScore(sentence string, hmm bool) ([]string, float64) {
+	s := seg.pinned()
+	var words []string
+	logProb, runes := 0.0, 0
+	_, logTotal := s.dict.totals()
+	if math.IsInf(logTotal, -1) {
+		logTotal = 0.0
+	}
+	s.CutFunc(sentence, hmm, func(word string) bool {
+		words = append(words, word)
+		if freq, ok := s.dict.Frequency(word); ok && freq > 0.0 {
+			logProb += math.Log(freq)
+		}
+		logProb -= logTotal
+		runes += utf8.RuneCountInString(word)
+		return true
+	})
+	if runes == 0 {
+		return words, 0.0
+	}
+	return words, logProb / float64(runes)
+}
+
+// CutFiltered cuts a sentence into words using accurate mode, like Cut, but
+// omits words made of punctuations only if dropPunct is true, and words made
+// of whitespaces only if dropSpace is true. Punctuations and whitespaces are
+// classified by unicode.IsPunct and unicode.IsSpace, so CJK punctuations
+// like "，" and "。" and the ideographic space are handled too.
+func (seg *Segmenter) CutFiltered(sentence string, hmm bool, dropPunct, dropSpace bool) <-chan string {
 	result := make(chan string)
+	words := seg.Cut(sentence, hmm)
 	go func() {
-		runes := []rune(sentence)
-		dag := seg.dag(runes)
-		start := -1
-		ks := make([]int, len(dag))
-		for k := range dag {
-			ks[k] = k
-		}
-		var l []int
-		for k := range ks {
-			l = dag[k]
-			if len(l) == 1 && k > start {
-				result <- string(runes[k : l[0]+1])
-				start = l[0]
+		for word := range words {
+			if dropPunct && isAll(word, unicode.IsPunct) {
 				continue
 			}
-			for _, j := range l {
-				if j > k {
-					result <- string(runes[k : j+1])
-					start = j
-				}
+			if dropSpace && isAll(word, unicode.IsSpace) {
+				continue
 			}
+			result <- word
 		}
 		close(result)
 	}()
 	return result
 }
 
+// isAll reports whether word is not empty and f is true for all its runes.
+func isAll(word string, f func(rune) bool) bool {
+	for _, r := range word {
+		if !f(r) {
+			return false
+		}
+	}
+	return len(word) > 0
+}
+
+// CutUnique cuts a sentence into words using accurate mode, like Cut, but
+// returns every distinct word only once. The words are ordered by their first
+// appearance in the sentence.
+func (seg *Segmenter) CutUnique(sentence string, hmm bool) []string {
+	var words []string
+	seen := make(map[string]bool)
+	for word := range seg.Cut(sentence, hmm) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func isSentenceBoundary(r rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '!', '?', ';', '\n':
+		return true
+	}
+	return false
+}
+
+// SplitSentences splits text into sentences after "。", "！", "？", "；", "!",
+// "?", ";" and newlines, the delimiters are kept at the end of the preceding
+// sentence, consecutive delimiters are kept together. Concatenating all the
+// sentences gives the original text.
+func SplitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	inDelimiters := false
+	for i, r := range text {
+		if isSentenceBoundary(r) {
+			inDelimiters = true
+			continue
+		}
+		if inDelimiters {
+			sentences = append(sentences, text[start:i])
+			start = i
+			inDelimiters = false
+		}
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// maxSentenceSize is the size of the longest sentence ScanSentences returns,
+// longer sentences are split at rune boundaries.
+const maxSentenceSize = 16 * 1024
+
+// ScanSentences is a split function for a bufio.Scanner that returns each
+// sentence of text, like SplitSentences does, except that consecutive
+// delimiters are not kept together. Sentences longer than 16KB are split.
+func ScanSentences(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, width := 0, 0; i < len(data); i += width {
+		if !atEOF && !utf8.FullRune(data[i:]) {
+			break
+		}
+		var r rune
+		r, width = utf8.DecodeRune(data[i:])
+		if isSentenceBoundary(r) {
+			return i + width, data[:i+width], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	if len(data) > maxSentenceSize {
+		end := maxSentenceSize
+		for end > 0 && !utf8.RuneStart(data[end]) {
+			end--
+		}
+		return end, data[:end], nil
+	}
+	return 0, nil, nil
+}
+
+// CutParallel cuts a sentence into words using accurate mode on several
+// goroutines. The sentence is split by SplitSentences, every piece is cutted
+// by one of the workers, and the result is exactly the same as CutToSlice.
+// The sentence is never split inside a match of the protect patterns.
+// If workers is not positive, runtime.NumCPU() is used.
+func (seg *Segmenter) CutParallel(sentence string, hmm bool, workers int) []string {
+	if strings.TrimSpace(sentence) == "" {
+		return nil
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	s := seg.pinned()
+	// the protect patterns are applied after normalization, so the sentence
+	// is normalized once here and the pieces are cutted without it
+	sentence = s.normalize(sentence)
+	s.NormalizeWidth, s.ConvertTraditional = false, false
+	pieces := splitOutside(SplitSentences(sentence), s.protectedSpans(sentence))
+	results := make([][]string, len(pieces))
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range tasks {
+				// pieces are cutted even if they are whitespace-only, like
+				// the white spaces inside the whole sentence
+				s.cutWords(pieces[index], hmm, func(word string) bool {
+					results[index] = append(results[index], word)
+					return true
+				})
+			}
+		}()
+	}
+	for index := range pieces {
+		tasks <- index
+	}
+	close(tasks)
+	wg.Wait()
+
+	var words []string
+	for _, result := range results {
+		words = append(words, result...)
+	}
+	return words
+}
+
+// splitOutside joins the adjacent pieces of a sentence split inside any of
+// the spans, which are byte offsets sorted by position.
+func splitOutside(pieces []string, spans [][]int) []string {
+	if len(spans) == 0 {
+		return pieces
+	}
+	var result []string
+	var b strings.Builder
+	end, k := 0, 0
+	for _, piece := range pieces {
+		b.WriteString(piece)
+		end += len(piece)
+		for k < len(spans) && spans[k][1] <= end {
+			k++
+		}
+		if k < len(spans) && spans[k][0] < end {
+			continue
+		}
+		result = append(result, b.String())
+		b.Reset()
+	}
+	if b.Len() > 0 {
+		result = append(result, b.String())
+	}
+	return result
+}
+
+func (seg *Segmenter) cutAll(sentence string) <-chan string {
+	result := make(chan string)
+	go func() {
+		seg.allWords(sentence, func(word string, start, end int) {
+			result <- word
+		})
+		close(result)
+	}()
+	return result
+}
+
+// allWords calls f with every word found in sentence by full mode, together
+// with its rune offsets [start, end) in sentence.
+func (seg *Segmenter) allWords(sentence string, f func(word string, start, end int)) {
+	sc := scratchPool.Get().(*scratch)
+	s, offsets := sc.index(sentence)
+	sc.dag = seg.dag(s, offsets, sc.dag)
+	dag := sc.dag
+	start := -1
+	var l []int
+	for k := range dag {
+		l = dag[k]
+		if len(l) == 1 && k > start {
+			f(s[offsets[k]:offsets[l[0]+1]], k, l[0]+1)
+			start = l[0]
+			continue
+		}
+		for _, j := range l {
+			if j > k {
+				f(s[offsets[k]:offsets[j+1]], k, j+1)
+				start = j
+			}
+		}
+	}
+	scratchPool.Put(sc)
+}
+
 // CutAll cuts a sentence into words using full mode.
-// Full mode gets all the possible words from the sentence.
+// Full mode gets all the possible words from the sentence, overlapping words
+// are all emitted and the Hidden Markov Model is never used.
 // Fast but not accurate.
 func (seg *Segmenter) CutAll(sentence string) <-chan string {
+	s := seg.pinned()
+	sentence = s.normalize(sentence)
 	result := make(chan string)
 	go func() {
 		for _, block := range util.RegexpSplit(reHanCutAll, sentence, -1) {
@@ -337,7 +1313,7 @@ func (seg *Segmenter) CutAll(sentence string) <-chan string {
 				continue
 			}
 			if reHanCutAll.MatchString(block) {
-				for x := range seg.cutAll(block) {
+				for x := range s.cutAll(block) {
 					result <- x
 				}
 				continue
@@ -351,30 +1327,190 @@ func (seg *Segmenter) CutAll(sentence string) <-chan string {
 	return result
 }
 
+// tokenizeAll returns the tokens of CutAll.
+func (seg *Segmenter) tokenizeAll(sentence string) []Token {
+	var tokens []Token
+	offset := 0
+	for _, block := range util.RegexpSplit(reHanCutAll, seg.normalize(sentence), -1) {
+		if len(block) == 0 {
+			continue
+		}
+		if reHanCutAll.MatchString(block) {
+			seg.allWords(block, func(word string, start, end int) {
+				tokens = append(tokens, Token{Text: word, Start: offset + start, End: offset + end})
+			})
+		} else {
+			// Sub blocks are separated by exactly one rune.
+			start := offset
+			for _, subBlock := range reSkipCutAll.Split(block, -1) {
+				width := utf8.RuneCountInString(subBlock)
+				tokens = append(tokens, Token{Text: subBlock, Start: start, End: start + width})
+				start += width + 1
+			}
+		}
+		offset += utf8.RuneCountInString(block)
+	}
+	return tokens
+}
+
+// subWords calls f with the rune offsets [start, end) of the short words of
+// word in search engine mode: if word is longer than 2 runes, its 2-grams
+// found in the dictionary from left to right, then its 3-grams if it is
+// longer than 3 runes.
+func (seg *Segmenter) subWords(runes []rune, f func(start, end int)) {
+	for _, increment := range []int{2, 3} {
+		if len(runes) <= increment {
+			continue
+		}
+		for i := 0; i < len(runes)-increment+1; i++ {
+			gram := string(runes[i : i+increment])
+			if v, ok := seg.dict.Frequency(gram); ok && v > 0.0 {
+				f(i, i+increment)
+			}
+		}
+	}
+}
+
 // CutForSearch cuts sentence into words using search engine mode.
 // Search engine mode, based on the accurate mode, attempts to cut long words
 // into several short words, which can raise the recall rate.
+// For every word longer than 2 runes, its 2-grams found in the dictionary
+// are emitted first, then its 3-grams found in the dictionary if it is longer
+// than 3 runes, both from left to right, and the long word itself is emitted
+// last.
 // Suitable for search engines.
 func (seg *Segmenter) CutForSearch(sentence string, hmm bool) <-chan string {
+	s := seg.pinned()
 	result := make(chan string)
 	go func() {
-		for word := range seg.Cut(sentence, hmm) {
+		for word := range s.Cut(sentence, hmm) {
 			runes := []rune(word)
-			for _, increment := range []int{2, 3} {
-				if len(runes) <= increment {
-					continue
-				}
-				var gram string
-				for i := 0; i < len(runes)-increment+1; i++ {
-					gram = string(runes[i : i+increment])
-					if v, ok := seg.dict.Frequency(gram); ok && v > 0.0 {
-						result <- gram
-					}
-				}
-			}
+			s.subWords(runes, func(start, end int) {
+				result <- string(runes[start:end])
+			})
 			result <- word
 		}
 		close(result)
 	}()
 	return result
 }
+
+// CutForSearchToSlice cuts sentence into words using search engine mode, like
+// CutForSearch, but returns all the words in a slice, in the same order.
+func (seg *Segmenter) CutForSearchToSlice(sentence string, hmm bool) []string {
+	s := seg.pinned()
+	var words []string
+	for word := range s.Cut(sentence, hmm) {
+		runes := []rune(word)
+		s.subWords(runes, func(start, end int) {
+			words = append(words, string(runes[start:end]))
+		})
+		words = append(words, word)
+	}
+	return words
+}
+
+// Tokenize modes.
+const (
+	DefaultMode = "default"
+	SearchMode  = "search"
+	FullMode    = "full"
+)
+
+// Token represents a word with its start and end position in the sentence.
+// Start and End are rune offsets, End is exclusive.
+type Token struct {
+	Text       string
+	Start, End int
+}
+
+// RuneSubstring returns the substring of s from rune index startRune to
+// endRune (exclusive), e.g. the Text of a Token is
+// RuneSubstring(sentence, token.Start, token.End). Both indexes are clamped
+// to [0, utf8.RuneCountInString(s)], an empty string is returned if endRune
+// is not larger than startRune.
+func RuneSubstring(s string, startRune, endRune int) string {
+	if startRune < 0 {
+		startRune = 0
+	}
+	if endRune <= startRune {
+		return ""
+	}
+	begin, end := len(s), len(s)
+	n := 0
+	for i := range s {
+		if n == startRune {
+			begin = i
+		}
+		if n == endRune {
+			end = i
+			break
+		}
+		n++
+	}
+	return s[begin:end]
+}
+
+// Tokenize cuts a sentence into tokens with their positions.
+// Parameter mode could be DefaultMode or SearchMode, in SearchMode the
+// 2-grams and 3-grams found in the dictionary of every long word are returned
+// before the word itself, like CutForSearch does. In FullMode the tokens are
+// the words emitted by CutAll in the same order, and hmm is ignored. Unknown
+// modes are treated as DefaultMode.
+func (seg *Segmenter) Tokenize(sentence string, mode string, hmm bool) []Token {
+	s := seg.pinned()
+	if mode == FullMode {
+		return s.tokenizeAll(sentence)
+	}
+	var tokens []Token
+	s.cutOffsets(sentence, hmm, func(word string, start int) bool {
+		runes := []rune(word)
+		if mode == SearchMode {
+			s.subWords(runes, func(i, j int) {
+				tokens = append(tokens, Token{Text: RuneSubstring(word, i, j), Start: start + i, End: start + j})
+			})
+		}
+		tokens = append(tokens, Token{Text: word, Start: start, End: start + len(runes)})
+		return true
+	})
+	return tokens
+}
+
+// cutOffsets cuts sentence like CutFunc, and calls fn for every word with its
+// rune offset in sentence. The offsets are counted on the untrimmed words, so
+// that they are still right if TrimTokens drops or trims any word.
+func (seg *Segmenter) cutOffsets(sentence string, hmm bool, fn func(word string, start int) bool) {
+	s := seg.pinned()
+	trim := s.TrimTokens
+	s.TrimTokens = false
+	end := 0
+	s.CutFunc(sentence, hmm, func(word string) bool {
+		width := utf8.RuneCountInString(word)
+		start := end
+		end += width
+		if trim {
+			trimmed := strings.TrimLeftFunc(word, unicode.IsSpace)
+			start += width - utf8.RuneCountInString(trimmed)
+			if word = strings.TrimRightFunc(trimmed, unicode.IsSpace); word == "" {
+				return true
+			}
+		}
+		return fn(word, start)
+	})
+}
+
+// IndexTerms cuts text using accurate mode with HMM, like Cut, and returns
+// the rune offsets of all the occurrences of every distinct word, in
+// ascending order, which is an entry of an inverted index for the document
+// docID. Words made of whitespaces only are omitted. docID only names the
+// document, it does not affect the result.
+func (seg *Segmenter) IndexTerms(docID string, text string) map[string][]int {
+	terms := make(map[string][]int)
+	seg.cutOffsets(text, true, func(word string, start int) bool {
+		if !isAll(word, unicode.IsSpace) {
+			terms[word] = append(terms[word], start)
+		}
+		return true
+	})
+	return terms
+}
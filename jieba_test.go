@@ -1,6 +1,16 @@
 package jiebago
 
-import "testing"
+import (
+	"bufio"
+	"context"
+	"math"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
 
 var (
 	seg          Segmenter
@@ -627,15 +637,24 @@ func chanToArray(ch <-chan string) []string {
 	return result
 }
 
+func cutToArray(cut cutFunc, sentence string) []string {
+	var result []string
+	cut(sentence, func(word string) bool {
+		result = append(result, word)
+		return true
+	})
+	return result
+}
+
 func TestCutDAG(t *testing.T) {
-	result := chanToArray(seg.cutDAG("BP神经网络如何训练才能在分类时增加区分度？"))
+	result := cutToArray(seg.cutDAG, "BP神经网络如何训练才能在分类时增加区分度？")
 	if len(result) != 11 {
 		t.Fatal(result)
 	}
 }
 
 func TestCutDAGNoHmm(t *testing.T) {
-	result := chanToArray(seg.cutDAGNoHMM("BP神经网络如何训练才能在分类时增加区分度？"))
+	result := cutToArray(seg.cutDAGNoHMM, "BP神经网络如何训练才能在分类时增加区分度？")
 	if len(result) != 11 {
 		t.Fatal(result)
 	}
@@ -659,6 +678,720 @@ func TestDefaultCut(t *testing.T) {
 	}
 }
 
+func TestCutToSlice(t *testing.T) {
+	for _, content := range testContents {
+		for _, hmm := range []bool{true, false} {
+			expected := chanToArray(seg.Cut(content, hmm))
+			result := seg.CutToSlice(content, hmm)
+			if len(result) != len(expected) {
+				t.Fatalf("cut to slice for %s got %v, expected %v", content, result, expected)
+			}
+			for i, r := range result {
+				if r != expected[i] {
+					t.Fatalf("cut to slice for %s got %v, expected %v", content, result, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestLoadHMM(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("大厦 100\n"))
+	// A model cutting every character into a single character word.
+	err := s.LoadHMM(
+		strings.NewReader("P={'S': 0.0}"),
+		strings.NewReader("P={'S': {'S': 0.0}}"),
+		strings.NewReader("P={'S': {'杭': 0.0, '研': 0.0}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := s.CutToSlice("杭研大厦", true)
+	expected := []string{"杭", "研", "大厦"}
+	if len(result) != len(expected) {
+		t.Fatalf("got %v, expected %v", result, expected)
+	}
+	for i, r := range result {
+		if r != expected[i] {
+			t.Fatalf("got %v, expected %v", result, expected)
+		}
+	}
+
+	// A model cutting "杭研" into one word.
+	err = s.LoadHMM(
+		strings.NewReader("P={'B': 0.0}"),
+		strings.NewReader("P={'B': {'E': 0.0}}"),
+		strings.NewReader("P={'B': {'杭': 0.0}, 'E': {'研': 0.0}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := s.CutToSlice("杭研大厦", true); len(result) != 2 || result[0] != "杭研" {
+		t.Fatalf("got %v, expected [杭研 大厦]", result)
+	}
+
+	if err := s.LoadHMM(strings.NewReader("P="), strings.NewReader("P={}"), strings.NewReader("P={}")); err == nil {
+		t.Fatal("expected an error for malformed model")
+	}
+	if result := s.CutToSlice("杭研大厦", true); len(result) != 2 || result[0] != "杭研" {
+		t.Fatalf("got %v, the current model should be kept after an error", result)
+	}
+}
+
+func TestBuildDAG(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("北京 100\n北京大学 100\n大学 100\n学 10\n"))
+	dag := s.BuildDAG("北京大学生")
+	expected := map[int][]int{0: {1, 3}, 1: {1}, 2: {3}, 3: {3}, 4: {4}}
+	if len(dag) != len(expected) {
+		t.Fatalf("got %v, expected %v", dag, expected)
+	}
+	for k, ends := range expected {
+		if len(dag[k]) != len(ends) {
+			t.Fatalf("got %v, expected %v", dag, expected)
+		}
+		for i := range ends {
+			if dag[k][i] != ends[i] {
+				t.Fatalf("got %v, expected %v", dag, expected)
+			}
+		}
+	}
+}
+
+func TestCutWithSource(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("他 100\n来到 100\n了 100\n网易 100\n大厦 100\n"))
+	tokens := s.CutWithSource("他来到了网易杭研大厦", true)
+	expected := []TokenSource{{"他", true}, {"来到", true}, {"了", true}, {"网易", true}, {"杭研", false}, {"大厦", true}}
+	if len(tokens) != len(expected) {
+		t.Fatalf("got %v, expected %v", tokens, expected)
+	}
+	for i, token := range tokens {
+		if token != expected[i] {
+			t.Fatalf("got %v, expected %v", tokens, expected)
+		}
+	}
+}
+
+func TestTrimTokens(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("北京 100\n天安门 100\n"))
+	s.AddWord("machine learning", 100, "")
+	s.MergeEnglishPhrases = true
+	s.AddProtectPattern(regexp.MustCompile(` #[^#]+# `))
+	sentence := "  北京\t天安门\r\n machine learning #话题# 。"
+	if result := s.CutToSlice(sentence, true); len(result) != 10 {
+		t.Fatalf("got %q, expected white spaces emitted by default", result)
+	}
+	s.TrimTokens = true
+	expected := []string{"北京", "天安门", "machine learning", "#话题#", "。"}
+	for _, hmm := range []bool{true, false} {
+		result := chanToArray(s.Cut(sentence, hmm))
+		if len(result) != len(expected) {
+			t.Fatalf("got %q, expected %q", result, expected)
+		}
+		for i := range result {
+			if result[i] != expected[i] {
+				t.Fatalf("got %q, expected %q", result, expected)
+			}
+		}
+	}
+
+	tokens := s.Tokenize(sentence, DefaultMode, true)
+	expectedTokens := []Token{{"北京", 2, 4}, {"天安门", 5, 8}, {"machine learning", 11, 27}, {"#话题#", 28, 32}, {"。", 33, 34}}
+	if len(tokens) != len(expectedTokens) {
+		t.Fatalf("got %v, expected %v", tokens, expectedTokens)
+	}
+	runes := []rune(sentence)
+	for i, token := range tokens {
+		if token != expectedTokens[i] || string(runes[token.Start:token.End]) != token.Text {
+			t.Fatalf("got %v, expected %v", tokens, expectedTokens)
+		}
+	}
+	terms := s.IndexTerms("doc", "北京 天安门 北京")
+	if len(terms["北京"]) != 2 || terms["北京"][0] != 0 || terms["北京"][1] != 7 || terms["天安门"][0] != 3 {
+		t.Fatalf("got %v, expected 北京 at 0 and 7, 天安门 at 3", terms)
+	}
+}
+
+func TestCutNewline(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("北京 100\n京天 1000\n天安门 100\n"))
+	s.AddWord("machine learning", 100, "")
+	s.MergeEnglishPhrases = true
+	s.AddProtectPattern(regexp.MustCompile(`#[^#]+#`))
+	sentence := "北京\n天安门,machine\nlearning\r\n#话题\r\n标签#"
+	expected := []string{"北京", "\n", "天安门", ",", "machine", "\n", "learning", "\r\n", "#话题", "\r\n", "标签#"}
+	for _, hmm := range []bool{true, false} {
+		result := s.CutToSlice(sentence, hmm)
+		if len(result) != len(expected) {
+			t.Fatalf("got %q, expected %q", result, expected)
+		}
+		for i := range result {
+			if result[i] != expected[i] {
+				t.Fatalf("got %q, expected %q", result, expected)
+			}
+		}
+	}
+}
+
+func TestAddProtectPattern(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("访问 100\n联系 100\n我们 100\n"))
+	s.AddProtectPattern(regexp.MustCompile(`https?://[a-zA-Z0-9./_-]+`))
+	s.AddProtectPattern(regexp.MustCompile(`[a-zA-Z0-9._-]+@[a-zA-Z0-9.-]+`))
+	result := chanToArray(s.Cut("访问https://example.com/a_b联系us@example.com我们", false))
+	expected := []string{"访问", "https://example.com/a_b", "联系", "us@example.com", "我们"}
+	if len(result) != len(expected) {
+		t.Fatalf("got %q, expected %q", result, expected)
+	}
+	for i := range result {
+		if result[i] != expected[i] {
+			t.Fatalf("got %q, expected %q", result, expected)
+		}
+	}
+}
+
+func TestCutBlank(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("北京 100\n"))
+	for _, c := range []struct {
+		sentence string
+		expected []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{" \n\t　", nil},
+		{" 。", []string{" ", "。"}},
+		{"。", []string{"。"}},
+	} {
+		result := chanToArray(s.Cut(c.sentence, true))
+		if len(result) != len(c.expected) {
+			t.Fatalf("%q: got %q, expected %q", c.sentence, result, c.expected)
+		}
+		for i := range result {
+			if result[i] != c.expected[i] {
+				t.Fatalf("%q: got %q, expected %q", c.sentence, result, c.expected)
+			}
+		}
+	}
+	if words := s.CutParallel("\n北京\n", true, 2); len(words) != 3 || words[0] != "\n" {
+		t.Fatalf("got %q, expected the newlines around 北京", words)
+	}
+	if words := s.CutParallel("  ", true, 2); len(words) != 0 {
+		t.Fatalf("got %q, expected no words", words)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { chanToArray(s.Cut("", true)) }); allocs > 0 {
+		t.Fatalf("got %f allocations cutting empty sentence, expected none", allocs)
+	}
+}
+
+func TestCutBuffered(t *testing.T) {
+	for _, bufSize := range []int{-1, 0, 1, 64} {
+		result := chanToArray(seg.CutBuffered(testContents[0], true, bufSize))
+		expected := chanToArray(seg.Cut(testContents[0], true))
+		if len(result) != len(expected) {
+			t.Fatalf("buffer size %d: got %q, expected %q", bufSize, result, expected)
+		}
+		for i := range result {
+			if result[i] != expected[i] {
+				t.Fatalf("buffer size %d: got %q, expected %q", bufSize, result, expected)
+			}
+		}
+	}
+}
+
+func TestMergeEnglishPhrases(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("学习 100\n"))
+	s.AddWord("machine learning", 100, "")
+	s.AddWord("machine learning model", 100, "")
+	sentence := "学习machine learning model and deep  learning"
+	for _, c := range []struct {
+		merge    bool
+		expected []string
+	}{
+		{false, []string{"学习", "machine", " ", "learning", " ", "model", " ", "and", " ", "deep", " ", " ", "learning"}},
+		{true, []string{"学习", "machine learning model", " ", "and", " ", "deep", " ", " ", "learning"}},
+	} {
+		s.MergeEnglishPhrases = c.merge
+		result := chanToArray(s.Cut(sentence, false))
+		if len(result) != len(c.expected) {
+			t.Fatalf("got %q, expected %q", result, c.expected)
+		}
+		for i := range result {
+			if result[i] != c.expected[i] {
+				t.Fatalf("got %q, expected %q", result, c.expected)
+			}
+		}
+	}
+}
+
+func TestCutRareWords(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("研究 1000\n研究生 1\n生命 1000\n起源 100\n的 100000000\n"))
+	sentence := strings.Repeat("研究生命", 500) + "起"
+	result := chanToArray(s.Cut(sentence, false))
+	if len(result) != 1001 {
+		t.Fatalf("got %d words, expected 1001", len(result))
+	}
+	for i, word := range result[:1000] {
+		if expected := []string{"研究", "生命"}[i%2]; word != expected {
+			t.Fatalf("got %q at %d, expected %q", word, i, expected)
+		}
+	}
+	if result[1000] != "起" {
+		t.Fatalf("got %q, expected 起 at the end", result[1000])
+	}
+}
+
+func TestCutWithWeights(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("他 100\n来到 300\n了 200\n网易 400\n大厦 500\n"))
+	tokens := s.CutWithWeights("他来到了网易杭研大厦", true)
+	expected := []WeightedToken{{"他", 100}, {"来到", 300}, {"了", 200}, {"网易", 400}, {"杭研", 300}, {"大厦", 500}}
+	if len(tokens) != len(expected) {
+		t.Fatalf("got %v, expected %v", tokens, expected)
+	}
+	for i, token := range tokens {
+		if token != expected[i] {
+			t.Fatalf("got %v, expected %v", tokens, expected)
+		}
+	}
+}
+
+func TestCutJoin(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("机器 100\n学习 100\n很 100\n有趣 100\n"))
+	if result := s.CutJoin("机器学习很有趣！", true, "/"); result != "机器/学习/很/有趣/！" {
+		t.Fatalf("got %s, expected 机器/学习/很/有趣/！", result)
+	}
+	if result := s.CutJoin("", true, "/"); result != "" {
+		t.Fatalf("got %q, expected an empty string", result)
+	}
+}
+
+func TestCutCompare(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("他 100\n来到 300\n了 200\n网易 400\n大厦 500\n"))
+	withHMM, withoutHMM, differ := s.CutCompare("他来到了网易杭研大厦")
+	if !differ || len(withHMM) != 6 || len(withoutHMM) != 7 {
+		t.Fatalf("got %q and %q, expected them to differ in 杭研", withHMM, withoutHMM)
+	}
+	if withHMM, withoutHMM, differ := s.CutCompare("他来到了网易大厦"); differ || len(withHMM) != len(withoutHMM) {
+		t.Fatalf("got %q and %q, expected the same words", withHMM, withoutHMM)
+	}
+}
+
+func TestCutWithScore(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("他 100\n来到 300\n了 200\n网易 200\n大厦 200\n"))
+	words, score := s.CutWithScore("他来到了网易大厦", true)
+	expected := []string{"他", "来到", "了", "网易", "大厦"}
+	if len(words) != len(expected) {
+		t.Fatalf("got %q, expected %q", words, expected)
+	}
+	for i := range words {
+		if words[i] != expected[i] {
+			t.Fatalf("got %q, expected %q", words, expected)
+		}
+	}
+	logProb := math.Log(100.0/1000) + math.Log(300.0/1000) + 3*math.Log(200.0/1000)
+	if math.Abs(score-logProb/8) > 1e-9 {
+		t.Fatalf("got score %f, expected %f", score, logProb/8)
+	}
+	if _, unknown := s.CutWithScore("他来到了杭研大厦", true); unknown >= score {
+		t.Fatalf("got score %f with unknown words, expected lower than %f", unknown, score)
+	}
+	if words, score := s.CutWithScore("", true); len(words) != 0 || score != 0 {
+		t.Fatalf("got %q and %f for empty sentence", words, score)
+	}
+}
+
+func TestLowercaseOutput(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("编程 100\nOpenAI 100\n"))
+	s.AddWord("Machine Learning", 100, "")
+	s.LowercaseOutput = true
+	s.MergeEnglishPhrases = true
+	result := chanToArray(s.Cut("Python3 编程OpenAI Machine Learning", false))
+	expected := []string{"python3", " ", "编程", "openai", " ", "machine learning"}
+	if len(result) != len(expected) {
+		t.Fatalf("got %q, expected %q", result, expected)
+	}
+	for i := range result {
+		if result[i] != expected[i] {
+			t.Fatalf("got %q, expected %q", result, expected)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("苹果 1000\n手机 1000\n苹 10\n果 10\n手 10\n机 10\n我 500\n买 500\n了 500\n"))
+	for _, c := range []struct {
+		fuzzy    bool
+		expected []string
+	}{
+		{false, []string{"我", "买", "了", "平", "果", "手机", "手", "手机"}},
+		{true, []string{"我", "买", "了", "平果", "手机", "手手机"}},
+	} {
+		s.FuzzyMatch = c.fuzzy
+		result := chanToArray(s.Cut("我买了平果手机手手机", false))
+		if len(result) != len(c.expected) {
+			t.Fatalf("got %q, expected %q", result, c.expected)
+		}
+		for i := range result {
+			if result[i] != c.expected[i] {
+				t.Fatalf("got %q, expected %q", result, c.expected)
+			}
+		}
+	}
+	if dag := s.BuildDAG("平果"); len(dag[0]) != 2 || dag[0][1] != 1 {
+		t.Fatalf("got %v, expected the fuzzy match 平果 in DAG", dag)
+	}
+}
+
+func TestMaxWordLen(t *testing.T) {
+	long := strings.Repeat("长", 50)
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader(long + " 100000\n长长 100\n长长长长长长长长 10\n"))
+	s.MaxWordLen = 8
+	for _, result := range [][]string{chanToArray(s.Cut(long, false)), chanToArray(s.CutAll(long))} {
+		if len(result) == 0 {
+			t.Fatal("got no words")
+		}
+		for _, word := range result {
+			if utf8.RuneCountInString(word) > 8 {
+				t.Fatalf("got %q, expected words of at most 8 runes", word)
+			}
+		}
+	}
+	s.MaxWordLen = 0
+	if result := chanToArray(s.Cut(long, false)); len(result) != 1 || result[0] != long {
+		t.Fatalf("got %q, expected the 50 runes word without limit", result)
+	}
+}
+
+func TestCutFunc(t *testing.T) {
+	for _, content := range testContents {
+		for _, hmm := range []bool{true, false} {
+			var result []string
+			seg.CutFunc(content, hmm, func(word string) bool {
+				result = append(result, word)
+				return true
+			})
+			expected := chanToArray(seg.Cut(content, hmm))
+			if len(result) != len(expected) {
+				t.Fatalf("got %q, expected %q", result, expected)
+			}
+			for i := range result {
+				if result[i] != expected[i] {
+					t.Fatalf("got %q, expected %q", result, expected)
+				}
+			}
+		}
+	}
+	var result []string
+	seg.CutFunc(testContents[0], true, func(word string) bool {
+		result = append(result, word)
+		return len(result) < 3
+	})
+	if len(result) != 3 {
+		t.Fatalf("got %q, expected to stop after 3 words", result)
+	}
+}
+
+func TestCutFiltered(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("我 100\n爱 100\n北京 100\n"))
+	sentence := "我爱北京！ 我爱 Go, 「北京」。"
+	for _, c := range []struct {
+		dropPunct, dropSpace bool
+		expected             []string
+	}{
+		{true, true, []string{"我", "爱", "北京", "我", "爱", "Go", "北京"}},
+		{true, false, []string{"我", "爱", "北京", " ", "我", "爱", " ", "Go", " ", "北京"}},
+		{false, true, []string{"我", "爱", "北京", "！", "我", "爱", "Go", ",", "「", "北京", "」", "。"}},
+	} {
+		result := chanToArray(s.CutFiltered(sentence, false, c.dropPunct, c.dropSpace))
+		if len(result) != len(c.expected) {
+			t.Fatalf("got %q, expected %q", result, c.expected)
+		}
+		for i, r := range result {
+			if r != c.expected[i] {
+				t.Fatalf("got %q, expected %q", result, c.expected)
+			}
+		}
+	}
+	if result, expected := chanToArray(s.CutFiltered(sentence, false, false, false)), s.CutToSlice(sentence, false); len(result) != len(expected) {
+		t.Fatalf("got %q, expected %q", result, expected)
+	}
+}
+
+func TestCutUnique(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("我 100\n爱 100\n北京 100\n和 100\n上海 100\n"))
+	result := s.CutUnique("我爱北京和上海，我爱北京", false)
+	expected := []string{"我", "爱", "北京", "和", "上海", "，"}
+	if len(result) != len(expected) {
+		t.Fatalf("got %v, expected %v", result, expected)
+	}
+	for i, r := range result {
+		if r != expected[i] {
+			t.Fatalf("got %v, expected %v", result, expected)
+		}
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"", nil},
+		{"没有标点", []string{"没有标点"}},
+		{"你好。我很好！你呢？", []string{"你好。", "我很好！", "你呢？"}},
+		{"真的吗？！是的;\n\nok!", []string{"真的吗？！", "是的;\n\n", "ok!"}},
+		{"。。开头；结尾", []string{"。。", "开头；", "结尾"}},
+	}
+	for _, test := range tests {
+		result := SplitSentences(test.text)
+		if len(result) != len(test.expected) {
+			t.Fatalf("split %q got %q, expected %q", test.text, result, test.expected)
+		}
+		for i, sentence := range result {
+			if sentence != test.expected[i] {
+				t.Fatalf("split %q got %q, expected %q", test.text, result, test.expected)
+			}
+		}
+	}
+}
+
+func TestScanSentences(t *testing.T) {
+	text := "你好。我很好！！\n" + strings.Repeat("长", maxSentenceSize) + "结尾"
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Split(ScanSentences)
+	var sentences []string
+	for scanner.Scan() {
+		sentences = append(sentences, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(sentences, "") != text {
+		t.Fatal("sentences should join to the original text")
+	}
+	expected := []string{"你好。", "我很好！", "！", "\n"}
+	for i, sentence := range expected {
+		if sentences[i] != sentence {
+			t.Fatalf("got %q, expected %q", sentences[:len(expected)], expected)
+		}
+	}
+	for _, sentence := range sentences {
+		if len(sentence) > maxSentenceSize || !utf8.ValidString(sentence) {
+			t.Fatalf("got invalid sentence of %d bytes", len(sentence))
+		}
+	}
+}
+
+func TestCutParallel(t *testing.T) {
+	content := strings.Join(testContents, "\n") + "\r\n结尾没有标点"
+	expected := seg.CutToSlice(content, true)
+	for _, workers := range []int{0, 1, 4} {
+		result := seg.CutParallel(content, true, workers)
+		if len(result) != len(expected) {
+			t.Fatalf("cut parallel with %d workers got %d words, expected %d", workers, len(result), len(expected))
+		}
+		for i, r := range result {
+			if r != expected[i] {
+				t.Fatalf("cut parallel with %d workers got %s at %d, expected %s", workers, r, i, expected[i])
+			}
+		}
+	}
+}
+
+func TestCutParallelProtected(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("访问 100\n看看 100\n"))
+	s.AddProtectPattern(regexp.MustCompile(`https?://[[:graph:]]+`))
+	s.NormalizeWidth = true
+	for _, content := range []string{"访问https://x.com/a?b=1;c=2看看", "访问ｈｔｔｐｓ://x.com/a?b=1;c=2 看看！访问;"} {
+		expected := s.CutToSlice(content, true)
+		for _, workers := range []int{1, 4} {
+			result := s.CutParallel(content, true, workers)
+			if len(result) != len(expected) {
+				t.Fatalf("got %q with %d workers, expected %q", result, workers, expected)
+			}
+			for i := range result {
+				if result[i] != expected[i] {
+					t.Fatalf("got %q with %d workers, expected %q", result, workers, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestCutContext(t *testing.T) {
+	content := strings.Join(testContents, "")
+	expected := seg.CutToSlice(content, true)
+	result := chanToArray(seg.CutContext(context.Background(), content, true))
+	if len(result) != len(expected) {
+		t.Fatalf("cut context got %d words, expected %d", len(result), len(expected))
+	}
+
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		words := seg.CutContext(ctx, content, true)
+		<-words
+		cancel()
+		for range words {
+		}
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runtime.NumGoroutine() > goroutines {
+		t.Fatalf("got %d goroutines after cancel, expected %d", runtime.NumGoroutine(), goroutines)
+	}
+}
+
+func TestTokenizeSearchMode(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("中华 100\n华人 100\n人民 100\n共和 100\n共和国 100\n中华人民共和国 10000\n成立 100\n"))
+	sentence := "中华人民共和国成立"
+	expected := []Token{
+		{"中华", 0, 2},
+		{"华人", 1, 3},
+		{"人民", 2, 4},
+		{"共和", 4, 6},
+		{"共和国", 4, 7},
+		{"中华人民共和国", 0, 7},
+		{"成立", 7, 9},
+	}
+	for _, hmm := range []bool{true, false} {
+		tokens := s.Tokenize(sentence, SearchMode, hmm)
+		if len(tokens) != len(expected) {
+			t.Fatalf("got %v, expected %v", tokens, expected)
+		}
+		runes := []rune(sentence)
+		for i, token := range tokens {
+			if token != expected[i] || string(runes[token.Start:token.End]) != token.Text {
+				t.Fatalf("got %v, expected %v", token, expected[i])
+			}
+		}
+	}
+}
+
+func TestIndexTerms(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("北京 100\n天安门 100\n我 100\n爱 100\n"))
+	terms := s.IndexTerms("doc1", "我爱北京 天安门，我爱北京")
+	expected := map[string][]int{"我": {0, 9}, "爱": {1, 10}, "北京": {2, 11}, "天安门": {5}, "，": {8}}
+	if len(terms) != len(expected) {
+		t.Fatalf("got %v, expected %v", terms, expected)
+	}
+	for term, positions := range expected {
+		if len(terms[term]) != len(positions) {
+			t.Fatalf("got %v for %s, expected %v", terms[term], term, positions)
+		}
+		for i := range positions {
+			if terms[term][i] != positions[i] {
+				t.Fatalf("got %v for %s, expected %v", terms[term], term, positions)
+			}
+		}
+	}
+	if terms := s.IndexTerms("doc2", ""); len(terms) != 0 {
+		t.Fatalf("got %v, expected no terms", terms)
+	}
+}
+
+func TestTokenizeFullMode(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("清华 100\n清华大学 100\n大学 100\n"))
+	for _, content := range append(testContents, "我在清华大学, 学习 C++ 和 Go。") {
+		expected := chanToArray(s.CutAll(content))
+		tokens := s.Tokenize(content, FullMode, true)
+		if len(tokens) != len(expected) {
+			t.Fatalf("got %v for %s, expected %v", tokens, content, expected)
+		}
+		runes := []rune(content)
+		for i, token := range tokens {
+			if token.Text != expected[i] || string(runes[token.Start:token.End]) != token.Text {
+				t.Fatalf("full mode token %v of %s, expected %s", token, content, expected[i])
+			}
+		}
+	}
+}
+
+func TestNormalizeWidth(t *testing.T) {
+	s := Segmenter{NormalizeWidth: true}
+	s.LoadDictionary("dict.txt")
+	result := s.CutToSlice("ＡＢＣ１２３", true)
+	if len(result) != 1 || result[0] != "ABC123" {
+		t.Fatalf("got %v, expected [ABC123]", result)
+	}
+	result = chanToArray(s.CutAll("ＡＢＣ"))
+	if len(result) != 1 || result[0] != "ABC" {
+		t.Fatalf("got %v, expected [ABC]", result)
+	}
+	tokens := s.Tokenize("我爱ＡＢＣ", DefaultMode, true)
+	last := tokens[len(tokens)-1]
+	if last.Text != "ABC" || last.Start != 2 || last.End != 5 {
+		t.Fatalf("got %v, expected ABC at [2, 5)", last)
+	}
+
+	s.NormalizeWidth = false
+	if result := s.CutToSlice("ＡＢＣ", true); len(result) != 3 {
+		t.Fatalf("got %v, expected 3 full-width words", result)
+	}
+}
+
+func TestConvertTraditional(t *testing.T) {
+	s := Segmenter{ConvertTraditional: true}
+	s.LoadDictionaryReader(strings.NewReader("我们 100\n喜欢 100\n学习 100\n中文 100\n"))
+	result := s.CutToSlice("我們喜歡學習中文", false)
+	expected := []string{"我们", "喜欢", "学习", "中文"}
+	if len(result) != len(expected) {
+		t.Fatalf("got %v, expected %v", result, expected)
+	}
+	for i, r := range result {
+		if r != expected[i] {
+			t.Fatalf("got %v, expected %v", result, expected)
+		}
+	}
+
+	s.ConvertTraditional = false
+	if result := s.CutToSlice("學習", false); len(result) != 2 {
+		t.Fatalf("got %v, expected 2 single Traditional characters", result)
+	}
+}
+
+func TestCutDeterministic(t *testing.T) {
+	content := strings.Join(testContents, "")
+	expected := chanToArray(seg.Cut(content, true))
+	expectedNoHMM := chanToArray(seg.Cut(content, false))
+	expectedAll := chanToArray(seg.CutAll(content))
+	for i := 0; i < 100; i++ {
+		for _, test := range []struct {
+			result, expected []string
+		}{
+			{chanToArray(seg.Cut(content, true)), expected},
+			{chanToArray(seg.Cut(content, false)), expectedNoHMM},
+			{chanToArray(seg.CutAll(content)), expectedAll},
+		} {
+			if len(test.result) != len(test.expected) {
+				t.Fatalf("run %d got %d words, expected %d", i, len(test.result), len(test.expected))
+			}
+			for j, word := range test.result {
+				if word != test.expected[j] {
+					t.Fatalf("run %d got %s at %d, expected %s", i, word, j, test.expected[j])
+				}
+			}
+		}
+	}
+}
+
 func TestCutAll(t *testing.T) {
 	var result []string
 	for index, content := range testContents {
@@ -693,6 +1426,21 @@ func TestDefaultCutNoHMM(t *testing.T) {
 	}
 }
 
+func TestCutNoHMM(t *testing.T) {
+	for _, content := range testContents {
+		expected := chanToArray(seg.Cut(content, false))
+		result := chanToArray(seg.CutNoHMM(content))
+		if len(result) != len(expected) {
+			t.Fatalf("cut no hmm for %s got %v, expected %v", content, result, expected)
+		}
+		for i, c := range result {
+			if c != expected[i] {
+				t.Fatalf("cut no hmm for %s got %v, expected %v", content, result, expected)
+			}
+		}
+	}
+}
+
 func TestCutForSearch(t *testing.T) {
 	var result []string
 	for index, content := range testContents {
@@ -721,6 +1469,23 @@ func TestCutForSearch(t *testing.T) {
 	}
 }
 
+func TestCutForSearchToSlice(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("中国 100\n科学 100\n学院 100\n科学院 100\n中国科学院 100\n研究 100\n"))
+	sentence := "中国科学院研究"
+	result := s.CutForSearchToSlice(sentence, false)
+	expected := []string{"中国", "科学", "学院", "科学院", "中国科学院", "研究"}
+	channel := chanToArray(s.CutForSearch(sentence, false))
+	if len(result) != len(expected) || len(channel) != len(expected) {
+		t.Fatalf("got %q and %q, expected %q", result, channel, expected)
+	}
+	for i := range result {
+		if result[i] != expected[i] || channel[i] != expected[i] {
+			t.Fatalf("got %q and %q, expected %q", result, channel, expected)
+		}
+	}
+}
+
 func TestLoadDictionary(t *testing.T) {
 	var result []string
 	seg.LoadDictionary("foobar.txt")
@@ -739,6 +1504,26 @@ func TestLoadDictionary(t *testing.T) {
 	seg.LoadDictionary("dict.txt")
 }
 
+func TestLoadDictionaries(t *testing.T) {
+	var s Segmenter
+	if err := s.LoadDictionaries("foobar.txt", "userdict.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if freq, ok := s.Frequency("好人"); !ok || freq != 12 {
+		t.Fatalf("got frequency %f for 好人, expected 12", freq)
+	}
+	if freq, ok := s.Frequency("李小福"); !ok || freq != 2 {
+		t.Fatalf("got frequency %f for 李小福, expected 2", freq)
+	}
+	err := s.LoadDictionaries("userdict.txt", "nonexistent.txt")
+	if err == nil || !strings.HasPrefix(err.Error(), "nonexistent.txt: ") {
+		t.Fatalf("got error %v, expected one telling nonexistent.txt", err)
+	}
+	if _, ok := s.Frequency("好人"); !ok {
+		t.Fatal("previous dictionary should be kept if any file fails")
+	}
+}
+
 func TestLoadUserDictionary(t *testing.T) {
 	seg.LoadUserDictionary("userdict.txt")
 
@@ -782,6 +1567,449 @@ func TestLoadUserDictionary(t *testing.T) {
 	seg.LoadDictionary("dict.txt")
 }
 
+func TestLoadUserDictionaryScaled(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("中国 1000\n北京 3000\n"))
+	if err := s.LoadUserDictionaryScaled("userdict.txt", 10); err != nil {
+		t.Fatal(err)
+	}
+	if freq, _ := s.Frequency("李小福"); freq != 20 {
+		t.Fatalf("got frequency %f for 李小福, expected 20", freq)
+	}
+
+	s.LoadDictionaryReader(strings.NewReader("中国 1000\n北京 3000\n"))
+	if err := s.LoadUserDictionaryScaled("foobar.txt", 0); err != nil {
+		t.Fatal(err)
+	}
+	if freq, _ := s.Frequency("好人"); freq != 2000 {
+		t.Fatalf("got frequency %f for 好人, expected the mean frequency 2000", freq)
+	}
+	if freq, _ := s.Frequency("北京"); freq != 3000 {
+		t.Fatalf("got frequency %f for 北京, main words should not be scaled", freq)
+	}
+}
+
+func TestLoadDictionaryReader(t *testing.T) {
+	var s Segmenter
+	if err := s.LoadDictionaryReader(strings.NewReader("云计算 5\n专家 3 n\n")); err != nil {
+		t.Fatal(err)
+	}
+	if freq, ok := s.Frequency("云计算"); !ok || freq != 5 {
+		t.Fatalf("got frequency %f for 云计算, expected 5", freq)
+	}
+	if pos, ok := s.Pos("专家"); !ok || pos != "n" {
+		t.Fatalf("got pos %s for 专家, expected n", pos)
+	}
+	if err := s.LoadUserDictionaryReader(strings.NewReader("云计算 five\n")); err == nil {
+		t.Fatal("expected an error for malformed line")
+	}
+}
+
+func TestNewWithDefault(t *testing.T) {
+	s, err := NewWithDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Frequency("AT&T"); !ok {
+		t.Fatal("AT&T should be in the bundled dictionary")
+	}
+}
+
+func TestLoadUserDictionaryReader(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("云计算 5\n专家 3 n\n"))
+	if err := s.LoadUserDictionaryReader(strings.NewReader("专家 10 nz\n创新办 3 i\n")); err != nil {
+		t.Fatal(err)
+	}
+	if freq, _ := s.Frequency("云计算"); freq != 5 {
+		t.Fatalf("got frequency %f for 云计算, expected 5", freq)
+	}
+	if freq, _ := s.Frequency("专家"); freq != 10 {
+		t.Fatalf("got frequency %f for 专家, expected 10", freq)
+	}
+	if pos, _ := s.Pos("专家"); pos != "nz" {
+		t.Fatalf("got pos %s for 专家, expected nz", pos)
+	}
+	if freq, _ := s.Frequency("创新办"); freq != 3 {
+		t.Fatalf("got frequency %f for 创新办, expected 3", freq)
+	}
+
+	var empty Segmenter
+	if err := empty.LoadUserDictionaryReader(strings.NewReader("创新办 3 i\n")); err != nil {
+		t.Fatal(err)
+	}
+	if freq, _ := empty.Frequency("创新办"); freq != 3 {
+		t.Fatalf("got frequency %f for 创新办, expected 3", freq)
+	}
+}
+
+func TestFrequency(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("云计算 5\n"))
+	if freq, ok := s.Frequency("云计算"); !ok || freq != 5 {
+		t.Fatalf("got frequency %f, %v for 云计算, expected 5, true", freq, ok)
+	}
+	for _, word := range []string{"云", "云计", "计算"} {
+		if freq, ok := s.Frequency(word); ok || freq != 0 {
+			t.Fatalf("got frequency %f, %v for %s, expected 0, false", freq, ok, word)
+		}
+	}
+	s.DeleteWord("云计算")
+	if _, ok := s.Frequency("云计算"); ok {
+		t.Fatal("云计算 should not exist after DeleteWord")
+	}
+}
+
+func TestReload(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("云计算 5\n"))
+	if err := s.ReloadReader(strings.NewReader("云计算 five\n")); err == nil {
+		t.Fatal("expected an error for malformed line")
+	}
+	if freq, _ := s.Frequency("云计算"); freq != 5 {
+		t.Fatalf("got frequency %f for 云计算, expected the old dictionary is kept", freq)
+	}
+	if err := s.ReloadReader(strings.NewReader("专家 3 n\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Frequency("云计算"); ok {
+		t.Fatal("云计算 should not exist after Reload")
+	}
+	if freq, _ := s.Frequency("专家"); freq != 3 {
+		t.Fatalf("got frequency %f for 专家, expected 3", freq)
+	}
+	if err := s.Reload("dict.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Frequency("专家"); ok {
+		t.Fatal("专家 should not exist after Reload")
+	}
+}
+
+func TestReloadWhileCutting(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionary("dict.txt")
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			s.CutToSlice(testContents[i%len(testContents)], true)
+			chanToArray(s.CutForSearch(testContents[i%len(testContents)], true))
+		}
+		done <- true
+	}()
+	for i := 0; i < 10; i++ {
+		s.Reload("userdict.txt")
+		s.Reload("dict.txt")
+	}
+	<-done
+}
+
+func TestAddWord(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionary("dict.txt")
+	sentence := "他是石墨烯专家"
+	s.AddWord("石墨烯", 0, "n")
+	if freq, ok := s.Frequency("石墨烯"); !ok || freq <= 0 {
+		t.Fatalf("got frequency %f for 石墨烯, expected a suggested frequency", freq)
+	}
+	if pos, _ := s.Pos("石墨烯"); pos != "n" {
+		t.Fatalf("got pos %s for 石墨烯, expected n", pos)
+	}
+	found := false
+	for _, word := range s.CutToSlice(sentence, false) {
+		if word == "石墨烯" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("石墨烯 should be cutted out after AddWord, got %v", s.CutToSlice(sentence, false))
+	}
+
+	s.DeleteWord("石墨烯")
+	for _, word := range s.CutToSlice(sentence, false) {
+		if word == "石墨烯" {
+			t.Fatalf("石墨烯 should not be cutted out after DeleteWord")
+		}
+	}
+}
+
+func TestSuggestFreq(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("台 5000\n中 5000\n台中 1\n正确 300\n应该 300\n不会 300\n被 300\n切开 300\n"))
+	sentence := "「台中」正确应该不会被切开"
+	contains := func(words []string, word string) bool {
+		for _, w := range words {
+			if w == word {
+				return true
+			}
+		}
+		return false
+	}
+	if words := s.CutToSlice(sentence, false); contains(words, "台中") {
+		t.Fatalf("台中 should be cutted apart before SuggestFreq, got %v", words)
+	}
+	freq := s.SuggestFreq("台中")
+	if got, _ := s.Frequency("台中"); got != freq || freq <= 1 {
+		t.Fatalf("got frequency %f for 台中, expected suggested frequency %f", got, freq)
+	}
+	if words := s.CutToSlice(sentence, false); !contains(words, "台中") {
+		t.Fatalf("台中 should be kept together after SuggestFreq, got %v", words)
+	}
+}
+
+func TestSuggestFreqZero(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("中将 1000\n中 10\n将 10\n出错 100\n"))
+	if freq := s.SuggestFrequency("中", "将"); freq != 0 {
+		t.Fatalf("got suggested frequency %f, expected 0", freq)
+	}
+	s.AddWord("中将", 0, "")
+	if words := s.CutToSlice("中将出错", false); words[0] != "中将" {
+		t.Fatalf("got %q, AddWord should keep 中将 together with frequency 0", words)
+	}
+	s.SuggestFreq("中", "将")
+	if words := s.CutToSlice("中将出错", false); len(words) != 3 || words[0] != "中" || words[1] != "将" {
+		t.Fatalf("got %q, SuggestFreq should cut 中将 apart", words)
+	}
+}
+
+func TestDictStats(t *testing.T) {
+	var s Segmenter
+	if total, count := s.DictStats(); total != 0 || count != 0 {
+		t.Fatalf("got %f and %d, expected zeros without dictionary", total, count)
+	}
+	s.LoadDictionaryReader(strings.NewReader("中国 100\n中国人 50\n人 30\n"))
+	if total, count := s.DictStats(); total != 180 || count != 3 {
+		t.Fatalf("got %f and %d, expected 180 and 3", total, count)
+	}
+	s.AddWord("中", 20, "")
+	if total, count := s.DictStats(); total != 200 || count != 4 {
+		t.Fatalf("got %f and %d, expected 200 and 4", total, count)
+	}
+}
+
+func TestTopWords(t *testing.T) {
+	var s Segmenter
+	if words := s.TopWords(3); len(words) != 0 {
+		t.Fatalf("got %v, expected none without dictionary", words)
+	}
+	s.LoadDictionaryReader(strings.NewReader("中国 100\n北京 300\n中国人 50\n上海 100\n好用\n"))
+	expected := []WeightedToken{{"北京", 300}, {"上海", 100}, {"中国", 100}}
+	words := s.TopWords(3)
+	if len(words) != len(expected) {
+		t.Fatalf("got %v, expected %v", words, expected)
+	}
+	for i := range words {
+		if words[i] != expected[i] {
+			t.Fatalf("got %v, expected %v", words, expected)
+		}
+	}
+	if words := s.TopWords(-1); len(words) != 4 {
+		t.Fatalf("got %v, expected all the 4 words with frequency", words)
+	}
+}
+
+func TestWordsWithPrefix(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("中国 100\n中国人 300\n中国人民 100\n中华 500\n国人 900\n"))
+	expected := []string{"中国人", "中国", "中国人民"}
+	words := s.WordsWithPrefix("中国", -1)
+	if len(words) != len(expected) {
+		t.Fatalf("got %q, expected %q", words, expected)
+	}
+	for i := range words {
+		if words[i] != expected[i] {
+			t.Fatalf("got %q, expected %q", words, expected)
+		}
+	}
+	if words := s.WordsWithPrefix("中", 2); len(words) != 2 || words[0] != "中华" || words[1] != "中国人" {
+		t.Fatalf("got %q, expected [中华 中国人]", words)
+	}
+	if words := s.WordsWithPrefix("美国", 5); words == nil || len(words) != 0 {
+		t.Fatalf("got %q, expected an empty slice", words)
+	}
+	s.AddWord("中国风", 1000, "")
+	s.DeleteWord("中国人")
+	if words := s.WordsWithPrefix("中国", -1); len(words) != 3 || words[0] != "中国风" || words[2] != "中国人民" {
+		t.Fatalf("got %q, expected [中国风 中国 中国人民] after changing the dictionary", words)
+	}
+}
+
+func TestSaveDictionary(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionaryReader(strings.NewReader("石墨 300 n\n烯 20\n专家 500 n\n"))
+	s.AddWord("石墨烯", 12.5, "n")
+	s.DeleteWord("烯")
+	var b strings.Builder
+	if err := s.SaveDictionary(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "专家 500 n\n石墨 300 n\n石墨烯 12.5 n\n"
+	if b.String() != expected {
+		t.Fatalf("got %q, expected %q", b.String(), expected)
+	}
+
+	var loaded Segmenter
+	if err := loaded.LoadDictionaryReader(strings.NewReader(b.String())); err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"专家", "石墨", "石墨烯", "烯"} {
+		freq, ok := s.Frequency(word)
+		loadedFreq, loadedOk := loaded.Frequency(word)
+		if freq != loadedFreq || ok != loadedOk {
+			t.Fatalf("got frequency %f for %s after reloading, expected %f", loadedFreq, word, freq)
+		}
+	}
+}
+
+func TestAddWordWhileCutting(t *testing.T) {
+	var s Segmenter
+	s.LoadDictionary("dict.txt")
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			s.CutToSlice(testContents[i%len(testContents)], true)
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		s.AddWord(testContents[i%len(testContents)], 0, "")
+	}
+	<-done
+}
+
+func TestRuneSubstring(t *testing.T) {
+	s := "永和服装饰品有限公司"
+	for _, c := range []struct {
+		start, end int
+		expected   string
+	}{
+		{0, 2, "永和"},
+		{2, 5, "服装饰"},
+		{6, 10, "有限公司"},
+		{-3, 2, "永和"},
+		{8, 100, "公司"},
+		{10, 12, ""},
+		{5, 5, ""},
+		{5, 3, ""},
+	} {
+		if sub := RuneSubstring(s, c.start, c.end); sub != c.expected {
+			t.Fatalf("[%d, %d): got %q, expected %q", c.start, c.end, sub, c.expected)
+		}
+	}
+	sentence := testContents[0]
+	for _, token := range seg.Tokenize(sentence, SearchMode, true) {
+		if sub := RuneSubstring(sentence, token.Start, token.End); sub != token.Text {
+			t.Fatalf("got %q for %v, expected the token text", sub, token)
+		}
+	}
+}
+
+func TestNormalizeChineseNumbers(t *testing.T) {
+	for _, c := range []struct {
+		text, expected string
+	}{
+		{"二零二三年", "2023年"},
+		{"一九四九年十二月一日", "1949年12月一日"},
+		{"十", "10"},
+		{"二十一个人", "21个人"},
+		{"一百零五", "105"},
+		{"两千块，两个人", "2000块，两个人"},
+		{"三百五", "350"},
+		{"三万五", "35000"},
+		{"一万零五", "10005"},
+		{"十二亿三千万", "1230000000"},
+		{"一样统一", "一样统一"},
+		{"三四个", "三四个"},
+		{"二三百", "二三百"},
+		{"十分感谢，千万别忘", "十分感谢，千万别忘"},
+		{"万物", "万物"},
+		{"零售", "零售"},
+		{"零件很贵", "零件很贵"},
+		{"十足", "十足"},
+		{"零", "零"},
+		{"2023年", "2023年"},
+	} {
+		if result := NormalizeChineseNumbers(c.text); result != c.expected {
+			t.Fatalf("%q: got %q, expected %q", c.text, result, c.expected)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	for _, content := range testContents {
+		runes := []rune(content)
+		end := 0
+		for _, token := range seg.Tokenize(content, DefaultMode, true) {
+			if token.Start != end {
+				t.Fatalf("token %v of %s should start at %d", token, content, end)
+			}
+			if string(runes[token.Start:token.End]) != token.Text {
+				t.Fatalf("token %v of %s has wrong offsets", token, content)
+			}
+			end = token.End
+		}
+		if end != len(runes) {
+			t.Fatalf("tokens of %s should end at %d, got %d", content, len(runes), end)
+		}
+
+		expected := chanToArray(seg.CutForSearch(content, true))
+		tokens := seg.Tokenize(content, SearchMode, true)
+		if len(tokens) != len(expected) {
+			t.Fatalf("search mode tokenize for %s got %v, expected %v", content, tokens, expected)
+		}
+		for i, token := range tokens {
+			if token.Text != expected[i] || string(runes[token.Start:token.End]) != token.Text {
+				t.Fatalf("search mode token %v of %s, expected %s", token, content, expected[i])
+			}
+		}
+	}
+}
+
+// naiveDAG builds the DAG by looking up every fragment with Frequency, it is
+// the reference of Segmenter.dag.
+func naiveDAG(d *Dictionary, runes []rune) [][]int {
+	dag := make([][]int, len(runes))
+	for k := range runes {
+		for i := k; i < len(runes); i++ {
+			freq, ok := d.Frequency(string(runes[k : i+1]))
+			if !ok {
+				break
+			}
+			if freq > 0.0 {
+				dag[k] = append(dag[k], i)
+			}
+		}
+		if len(dag[k]) == 0 {
+			dag[k] = append(dag[k], k)
+		}
+	}
+	return dag
+}
+
+func TestDAG(t *testing.T) {
+	for _, content := range append(testContents, "\xff坏的\xfeUTF-8") {
+		runes := []rune(content)
+		var sc scratch
+		s, offsets := sc.index(content)
+		dag := seg.dag(s, offsets, nil)
+		expected := naiveDAG(seg.dict, runes)
+		if len(dag) != len(expected) {
+			t.Fatalf("got DAG of length %d for %s, expected %d", len(dag), content, len(expected))
+		}
+		for k := range dag {
+			if len(dag[k]) != len(expected[k]) {
+				t.Fatalf("got %v at %d for %s, expected %v", dag[k], k, content, expected[k])
+			}
+			for i := range dag[k] {
+				if dag[k][i] != expected[k][i] {
+					t.Fatalf("got %v at %d for %s, expected %v", dag[k], k, content, expected[k])
+				}
+			}
+		}
+	}
+}
+
 func BenchmarkCutNoHMM(b *testing.B) {
 	sentence := "工信处女干事每月经过下属科室都要亲口交代24口交换机等技术性器件的安装工作"
 	b.ResetTimer()
@@ -798,6 +2026,54 @@ func BenchmarkCut(b *testing.B) {
 	}
 }
 
+func BenchmarkCutParagraph(b *testing.B) {
+	paragraph := strings.Join(testContents, "")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chanToArray(seg.Cut(paragraph, true))
+	}
+}
+
+// consumeSlowly reads all the words from ch, doing some light work for every
+// word and stalling once in a while.
+func consumeSlowly(ch <-chan string) {
+	n := 0
+	for word := range ch {
+		n += utf8.RuneCountInString(word)
+		if n%64 == 0 {
+			time.Sleep(time.Microsecond)
+		}
+	}
+}
+
+func BenchmarkCutUnbuffered(b *testing.B) {
+	paragraph := strings.Repeat(strings.Join(testContents, ""), 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		consumeSlowly(seg.Cut(paragraph, true))
+	}
+}
+
+func BenchmarkCutBuffered(b *testing.B) {
+	paragraph := strings.Repeat(strings.Join(testContents, ""), 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		consumeSlowly(seg.CutBuffered(paragraph, true, 128))
+	}
+}
+
+func BenchmarkCutFunc(b *testing.B) {
+	paragraph := strings.Join(testContents, "")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		seg.CutFunc(paragraph, true, func(word string) bool {
+			return true
+		})
+	}
+}
+
 func BenchmarkCutAll(b *testing.B) {
 	sentence := "工信处女干事每月经过下属科室都要亲口交代24口交换机等技术性器件的安装工作"
 	b.ResetTimer()
@@ -0,0 +1,204 @@
+package jiebago
+
+import (
+	"strconv"
+	"strings"
+)
+
+var chineseDigits = map[rune]int64{
+	'零': 0, '〇': 0, '一': 1, '二': 2, '三': 3, '四': 4,
+	'五': 5, '六': 6, '七': 7, '八': 8, '九': 9, '两': 2,
+}
+
+var chineseUnits = map[rune]int64{'十': 10, '百': 100, '千': 1000}
+
+// numeralWords are common words made of numerals which are not numbers, a
+// numeral sequence at the start of them is kept as is.
+var numeralWords = [][]rune{[]rune("十分"), []rune("千万"), []rune("万一"), []rune("万万"), []rune("一一")}
+
+func isChineseNumeral(r rune) bool {
+	if _, ok := chineseDigits[r]; ok {
+		return true
+	}
+	if _, ok := chineseUnits[r]; ok {
+		return true
+	}
+	return r == '万' || r == '亿'
+}
+
+/*
+NormalizeChineseNumbers converts Chinese numeral sequences in text to Arabic
+digits, so that "二零二三年" and "2023年" are treated the same. Two kinds of
+sequences are supported:
+
+	digit by digit, e.g. years and codes: "二零二三" to "2023", "一九四九" to "1949"
+	integers with units: "十" to "10", "二十一" to "21", "一百零五" to "105",
+	"两千" to "2000", "三万五" to "35000", "十二亿" to "1200000000"
+
+Integers from 0 up to 9999万9999亿9999万9999 are supported, decimals,
+fractions and negative numbers are not. To leave non-numeral uses of these
+characters alone, a single digit rune like "一" in "一样" is kept, "两" is only
+converted before a unit, a single numeral rune followed by other text like
+"零" in "零售" or "十" in "十足" is kept, malformed sequences like "二三百"
+are kept, and so are common words like "十分", "千万" and "万一".
+*/
+func NormalizeChineseNumbers(text string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	changed := false
+	for i := 0; i < len(runes); {
+		if !isChineseNumeral(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isChineseNumeral(runes[j]) {
+			j++
+		}
+		if number, ok := chineseNumber(runes[i:j], runes[i:]); ok {
+			b.WriteString(number)
+			changed = true
+		} else {
+			b.WriteString(string(runes[i:j]))
+		}
+		i = j
+	}
+	if !changed {
+		return text
+	}
+	return b.String()
+}
+
+// chineseNumber converts the numeral sequence run, rest is the text starting
+// from it, which is checked against numeralWords.
+func chineseNumber(run, rest []rune) (string, bool) {
+	for _, word := range numeralWords {
+		if len(rest) >= len(word) && string(rest[:len(word)]) == string(word) {
+			return "", false
+		}
+	}
+	// a single numeral rune followed by other text is a part of a word, e.g.
+	// "零售", "十足"
+	if len(run) == 1 && len(rest) > 1 {
+		return "", false
+	}
+	hasUnit, hasZero := false, false
+	for i, r := range run {
+		switch d, ok := chineseDigits[r]; {
+		case !ok:
+			hasUnit = true
+		case r == '两':
+			// "两" is only a number before a unit, e.g. "两百", not "两个"
+			if i+1 == len(run) {
+				return "", false
+			}
+			if _, ok := chineseDigits[run[i+1]]; ok {
+				return "", false
+			}
+		case d == 0:
+			hasZero = true
+		}
+	}
+	if !hasUnit {
+		// short sequences like "三四" are often approximations, not numbers
+		if len(run) < 2 || len(run) < 3 && !hasZero {
+			return "", false
+		}
+		var b strings.Builder
+		for _, r := range run {
+			b.WriteByte(byte('0' + chineseDigits[r]))
+		}
+		return b.String(), true
+	}
+	n, ok := chineseInteger(run, 100000000)
+	if !ok {
+		return "", false
+	}
+	return strconv.FormatInt(n, 10), true
+}
+
+// chineseInteger parses run as an integer below 10000 times the big unit,
+// which is 100000000 for "亿", 10000 for "万" or 1 for a section without them.
+func chineseInteger(run []rune, big int64) (int64, bool) {
+	if big == 1 {
+		return chineseSection(run)
+	}
+	sep, next := '亿', int64(10000)
+	if big == 10000 {
+		sep, next = '万', 1
+	}
+	i := strings.LastIndex(string(run), string(sep))
+	if i < 0 {
+		return chineseInteger(run, next)
+	}
+	k := len([]rune(string(run)[:i]))
+	left, right := run[:k], run[k+1:]
+	if len(left) == 0 {
+		return 0, false
+	}
+	high, ok := chineseInteger(left, next)
+	if !ok || high >= 10000*next {
+		return 0, false
+	}
+	// a bare digit right after a big unit is a short form, e.g. "三万五"
+	if len(right) == 1 {
+		if d, ok := chineseDigits[right[0]]; ok && d > 0 && right[0] != '两' {
+			return high*big + d*big/10, true
+		}
+	}
+	if len(right) == 0 {
+		return high * big, true
+	}
+	low, ok := chineseInteger(right, next)
+	if !ok {
+		return 0, false
+	}
+	return high*big + low, true
+}
+
+// chineseSection parses run as an integer below 10000 made of digits and
+// the units "十", "百" and "千".
+func chineseSection(run []rune) (int64, bool) {
+	var total int64
+	digit := int64(-1)
+	lastUnit := int64(10000)
+	zero := false
+	for i, r := range run {
+		if unit, ok := chineseUnits[r]; ok {
+			if unit >= lastUnit {
+				return 0, false
+			}
+			if digit < 0 {
+				// "十" at the start means "一十"
+				if unit != 10 || i != 0 {
+					return 0, false
+				}
+				digit = 1
+			}
+			total += digit * unit
+			digit, lastUnit, zero = -1, unit, false
+			continue
+		}
+		d := chineseDigits[r]
+		if d == 0 {
+			if digit >= 0 {
+				return 0, false
+			}
+			zero = true
+			continue
+		}
+		if digit >= 0 {
+			return 0, false
+		}
+		digit = d
+	}
+	if digit > 0 {
+		// a bare digit right after a unit is a short form, e.g. "三百五"
+		if !zero && lastUnit >= 100 && lastUnit < 10000 {
+			digit *= lastUnit / 10
+		}
+		total += digit
+	}
+	return total, len(run) > 0
+}
@@ -33,6 +33,12 @@ func (s Segment) Pos() string {
 	return s.pos
 }
 
+// Flag returns the Segment's POS, it is the same as Pos and named after
+// Jieba's pair.flag.
+func (s Segment) Flag() string {
+	return s.pos
+}
+
 // Segmenter is a Chinese words segmentation struct.
 type Segmenter struct {
 	dict *Dictionary
@@ -426,3 +426,11 @@ func BenchmarkCut(b *testing.B) {
 		chanToArray(seg.Cut(sentence, true))
 	}
 }
+
+func TestSegmentFlag(t *testing.T) {
+	for _, segment := range chanToArray(seg.Cut("我爱北京天安门", true)) {
+		if segment.Flag() != segment.Pos() {
+			t.Fatalf("%v: flag %s != pos %s", segment, segment.Flag(), segment.Pos())
+		}
+	}
+}
@@ -17,7 +17,7 @@ var ideographRegexp = regexp.MustCompile(`\p{Han}+`)
 
 // JiebaTokenizer is the beleve tokenizer for jiebago.
 type JiebaTokenizer struct {
-	seg             jiebago.Segmenter
+	seg             *jiebago.Segmenter
 	hmm, searchMode bool
 }
 
@@ -42,7 +42,7 @@ Parameters:
     this word into "交换", "换机", which are valid Chinese words.
 */
 func NewJiebaTokenizer(dictFilePath string, hmm, searchMode bool) (analysis.Tokenizer, error) {
-	var seg jiebago.Segmenter
+	seg := new(jiebago.Segmenter)
 	err := seg.LoadDictionary(dictFilePath)
 	return &JiebaTokenizer{
 		seg:        seg,
@@ -0,0 +1,61 @@
+package util
+
+import "strings"
+
+// traditionalChars and simplifiedChars are the common Traditional Chinese
+// characters and their Simplified forms, rune by rune.
+var (
+	traditionalChars = "亞來侖倉個們倫偉側備傳傷僅價儀億償優儲兩劉動務勞勢勵匯區厭參問喬單嗎嘗嚴國園圓圖" +
+		"團執報場塊壓壞壽夾婁孫學實寧審寫將專尋對屬岡師帶幾廣後從愛態慣慮慶憂憶應懷戀戰戲" +
+		"掃換揮損搖搶撲擁擇擊擔據擴擺攜敵數斷於時暫曆曉書會東條楊楓業極構槍樂樓標樣樹橋機" +
+		"檢權歐歡歲歷歸殘殺殼氣氫決沒況淚淺測湯準溫滅滿漁漢潔濃濕濟灣災為烏無煙熱燈燒營爭" +
+		"爺爾牆狀狹猶獨獲獻現瑪環產畝畢畫異當療癢發盜盡監盤盧眾睜碩確碼礎禍禮種稱積穩窮竄" +
+		"競筆筍節範築簡籃糧紀約紅純紙級細終組結絕給統絲經綠維網緊線緣編練縣總織續罷羅義習" +
+		"聖聞聯聲聶職聽肅腦膚臉臟臨臺與興舉舊艦莊華萬葉蒼蓋蔣薦藝藥蘇蘋蘭處虛虜號蝦蟲蠻術" +
+		"衛衝裏補裝裡製複襯見規視親覺覽觀訂計訊討訓託記訪設許診評詞試話詳認語誠誤說誰課調" +
+		"談請論諸謀講謝謠證識譯議護讀變讓讚豈豐貓貝貧貨責貴買費貿資賓賣質賬賴賺購賽贊贏趕" +
+		"趙跡踐躍車軍較載輕輛輩輪輸轉辦農這連週進運過達違遞遠適遲遷選遺邁還邊邏鄉鄭鄰醫釋" +
+		"針銀銷鋪鋼錄錢錯錶鍋鍾鎮鏈鏡鐘鐵長門閉開間閱闆闊關陰陳陸陽隊階際隨險隱隻雖雙雜雞" +
+		"離難雲電霧靈靜韋韓響頁頂項順須預頓領頭頻題額顏願類顯風颱颳飄飛飯飲飽餘館馬騎驅驗" +
+		"驚驛體髮鬆鬥鬧鬱魚魯鮮鳥鳳鴨鵝鹵麗麥麵麼黃點黨齊齒齡龍龜"
+	simplifiedChars = "亚来仑仓个们伦伟侧备传伤仅价仪亿偿优储两刘动务劳势励汇区厌参问乔单吗尝严国园圆图" +
+		"团执报场块压坏寿夹娄孙学实宁审写将专寻对属冈师带几广后从爱态惯虑庆忧忆应怀恋战戏" +
+		"扫换挥损摇抢扑拥择击担据扩摆携敌数断于时暂历晓书会东条杨枫业极构枪乐楼标样树桥机" +
+		"检权欧欢岁历归残杀壳气氢决没况泪浅测汤准温灭满渔汉洁浓湿济湾灾为乌无烟热灯烧营争" +
+		"爷尔墙状狭犹独获献现玛环产亩毕画异当疗痒发盗尽监盘卢众睁硕确码础祸礼种称积稳穷窜" +
+		"竞笔笋节范筑简篮粮纪约红纯纸级细终组结绝给统丝经绿维网紧线缘编练县总织续罢罗义习" +
+		"圣闻联声聂职听肃脑肤脸脏临台与兴举旧舰庄华万叶苍盖蒋荐艺药苏苹兰处虚虏号虾虫蛮术" +
+		"卫冲里补装里制复衬见规视亲觉览观订计讯讨训托记访设许诊评词试话详认语诚误说谁课调" +
+		"谈请论诸谋讲谢谣证识译议护读变让赞岂丰猫贝贫货责贵买费贸资宾卖质账赖赚购赛赞赢赶" +
+		"赵迹践跃车军较载轻辆辈轮输转办农这连周进运过达违递远适迟迁选遗迈还边逻乡郑邻医释" +
+		"针银销铺钢录钱错表锅钟镇链镜钟铁长门闭开间阅板阔关阴陈陆阳队阶际随险隐只虽双杂鸡" +
+		"离难云电雾灵静韦韩响页顶项顺须预顿领头频题额颜愿类显风台刮飘飞饭饮饱余馆马骑驱验" +
+		"惊驿体发松斗闹郁鱼鲁鲜鸟凤鸭鹅卤丽麦面么黄点党齐齿龄龙龟"
+)
+
+var simplified = make(map[rune]rune)
+
+func init() {
+	s := []rune(simplifiedChars)
+	for i, t := range []rune(traditionalChars) {
+		simplified[t] = s[i]
+	}
+}
+
+// Simplified converts a common Traditional Chinese character to its
+// Simplified form, other runes are returned unchanged.
+func Simplified(r rune) rune {
+	if s, ok := simplified[r]; ok {
+		return s
+	}
+	return r
+}
+
+// ToSimplified converts common Traditional Chinese characters in s to their
+// Simplified forms, see Simplified. The conversion is character by character,
+// not phrase by phrase, so characters with several Simplified forms depending
+// on the context are either kept or mapped to the most common one. Every rune
+// is mapped to exactly one rune, so rune offsets are kept.
+func ToSimplified(s string) string {
+	return strings.Map(Simplified, s)
+}
@@ -1,7 +1,10 @@
 // Package util contains some util functions used by jiebago.
 package util
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
 
 /*
 RegexpSplit split slices s into substrings separated by the expression and
@@ -51,3 +54,23 @@ func RegexpSplit(re *regexp.Regexp, s string, n int) []string {
 
 	return strings
 }
+
+// HalfWidth converts a full-width ASCII variant rune (U+FF01 to U+FF5E) and
+// the ideographic space (U+3000) to its half-width form, other runes are
+// returned unchanged.
+func HalfWidth(r rune) rune {
+	switch {
+	case r == '　':
+		return ' '
+	case r >= '！' && r <= '～':
+		return r - 0xfee0
+	}
+	return r
+}
+
+// NormalizeWidth converts all full-width ASCII variants in s to half-width
+// forms, see HalfWidth. Every rune is mapped to exactly one rune, so rune
+// offsets are kept.
+func NormalizeWidth(s string) string {
+	return strings.Map(HalfWidth, s)
+}
@@ -22,3 +22,32 @@ func TestRegexpSplit(t *testing.T) {
 		t.Fatal(result)
 	}
 }
+
+func TestNormalizeWidth(t *testing.T) {
+	tests := map[string]string{
+		"ＡＢＣ":       "ABC",
+		"ａｂｃ１２３":    "abc123",
+		"Ｃ＋＋　ｃ＃":    "C++ c#",
+		"中文，不变。":    "中文,不变。",
+		"mixed ＡＢＣ": "mixed ABC",
+	}
+	for input, expected := range tests {
+		if result := NormalizeWidth(input); result != expected {
+			t.Fatalf("NormalizeWidth(%q) = %q, expected %q", input, result, expected)
+		}
+	}
+}
+
+func TestToSimplified(t *testing.T) {
+	tests := map[string]string{
+		"我們喜歡學習中文": "我们喜欢学习中文",
+		"臺灣":       "台湾",
+		"简体不变":     "简体不变",
+		"mixed 電腦": "mixed 电脑",
+	}
+	for input, expected := range tests {
+		if result := ToSimplified(input); result != expected {
+			t.Fatalf("ToSimplified(%q) = %q, expected %q", input, result, expected)
+		}
+	}
+}